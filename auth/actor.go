@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"msrd-products/models"
+	"os"
+)
+
+// SystemActorId identifies writes made by the service itself rather than on behalf of a user.
+const SystemActorId = "system"
+
+type actorKey struct{}
+
+// ActorMiddleware resolves the actor of the request from the validated JWT
+// and passes it to repositories through the request user context.
+func ActorMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(WithActor(c.UserContext(), ActorFromToken(c)))
+		return c.Next()
+	}
+}
+
+// ActorFromToken takes the actor id from the sub claim and the display name from the claim
+// named by ACTOR_NAME_CLAIM (name by default), falling back to preferred_username.
+func ActorFromToken(c *fiber.Ctx) (actor models.Actor) {
+	claims := tokenClaims(c)
+	actor.Id, _ = claims["sub"].(string)
+
+	actor.Name, _ = claims[actorNameClaim()].(string)
+	if actor.Name == "" {
+		actor.Name, _ = claims["preferred_username"].(string)
+	}
+	return
+}
+
+func actorNameClaim() string {
+	if claim := os.Getenv("ACTOR_NAME_CLAIM"); claim != "" {
+		return claim
+	}
+	return "name"
+}
+
+// SystemActor is the actor of writes the service makes on its own, named after their source.
+func SystemActor(source string) models.Actor {
+	return models.Actor{Id: SystemActorId, Name: source}
+}
+
+func WithActor(ctx context.Context, actor models.Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) (actor models.Actor, ok bool) {
+	actor, ok = ctx.Value(actorKey{}).(models.Actor)
+	return
+}
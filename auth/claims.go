@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"strings"
+)
+
+func tokenClaims(c *fiber.Ctx) jwt.MapClaims {
+	token, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return nil
+	}
+
+	switch claims := token.Claims.(type) {
+	case *Claims:
+		return jwt.MapClaims(*claims)
+	case jwt.MapClaims:
+		return claims
+	default:
+		return nil
+	}
+}
+
+// claimStrings reads a claim that may hold a single string, a space separated list or an array of strings.
+func claimStrings(c *fiber.Ctx, name string) (values []string) {
+	switch claim := tokenClaims(c)[name].(type) {
+	case string:
+		values = strings.Fields(claim)
+	case []interface{}:
+		for _, item := range claim {
+			if value, ok := item.(string); ok {
+				values = append(values, value)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"sort"
+	"strings"
+)
+
+// FieldPolicy names the permission needed to read or to write individual fields of a resource.
+// Fields it does not list are governed by the route permission alone.
+type FieldPolicy struct {
+	Read  map[string]string
+	Write map[string]string
+}
+
+// WithOverrides returns a copy of the policy with entries replaced from a configuration value
+// such as "read:quantity=products:stock:read;write:name=products:name:write".
+func (policy FieldPolicy) WithOverrides(overrides string) FieldPolicy {
+	merged := FieldPolicy{Read: map[string]string{}, Write: map[string]string{}}
+	for field, permission := range policy.Read {
+		merged.Read[field] = permission
+	}
+	for field, permission := range policy.Write {
+		merged.Write[field] = permission
+	}
+
+	for _, entry := range strings.Split(overrides, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		access, rule, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		field, permission, found := strings.Cut(rule, "=")
+		if !found || strings.TrimSpace(field) == "" || strings.TrimSpace(permission) == "" {
+			log.Println("Invalid field permission override:", entry)
+			continue
+		}
+
+		switch access {
+		case "read":
+			merged.Read[strings.TrimSpace(field)] = strings.TrimSpace(permission)
+		case "write":
+			merged.Write[strings.TrimSpace(field)] = strings.TrimSpace(permission)
+		default:
+			log.Println("Invalid field permission override:", entry)
+		}
+	}
+
+	return merged
+}
+
+// Guarded reports whether any field needs a permission to be written.
+func (policy FieldPolicy) Guarded() bool {
+	return len(policy.Write) > 0
+}
+
+// HiddenFields lists the fields the caller may not read.
+func (policy FieldPolicy) HiddenFields(c *fiber.Ctx) []string {
+	return deniedFields(c, policy.Read, nil)
+}
+
+// ProtectedFields lists which of the given fields the caller may not write.
+func (policy FieldPolicy) ProtectedFields(c *fiber.Ctx, fields []string) []string {
+	return deniedFields(c, policy.Write, fields)
+}
+
+func deniedFields(c *fiber.Ctx, permissions map[string]string, fields []string) (denied []string) {
+	for field, permission := range permissions {
+		if fields != nil && !contains(fields, field) {
+			continue
+		}
+		if !HasPermission(c, permission) {
+			denied = append(denied, field)
+		}
+	}
+	sort.Strings(denied)
+	return
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	jwtware "github.com/gofiber/jwt/v3"
+	"github.com/golang-jwt/jwt/v4"
+	"msrd-products/utils"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	errTokenExpired     = errors.New("token is expired")
+	errTokenNotValidYet = errors.New("token is not valid yet")
+	errTokenIssuedLater = errors.New("token is issued in the future")
+	errTokenIssuer      = errors.New("token issuer is not accepted")
+	errTokenAudience    = errors.New("token audience is not accepted")
+)
+
+// JWTConfig describes how access tokens are verified. Keys come either from files, which lets tests
+// and local development sign tokens offline, or from JWKS URLs that are cached and refreshed in the background.
+// Key files take precedence, so key set URLs are ignored when any key file is configured.
+type JWTConfig struct {
+	KeyFiles          []string
+	KeySetURLs        []string
+	RefreshInterval   time.Duration
+	RefreshRateLimit  time.Duration
+	RefreshTimeout    time.Duration
+	RefreshUnknownKID bool
+	Issuers           []string
+	Audiences         []string
+	ClockSkew         time.Duration
+}
+
+// Claims holds the claims of a verified token. Its Valid method accepts everything because time,
+// issuer and audience checks need the configured clock skew and run after the signature is verified.
+type Claims map[string]interface{}
+
+func (Claims) Valid() error {
+	return nil
+}
+
+func JWTConfigFromEnv() JWTConfig {
+	config := JWTConfig{
+		KeyFiles:          listEnv("JWT_KEY_FILES"),
+		KeySetURLs:        listEnv("JWT_JWKS_URLS"),
+		RefreshInterval:   utils.DurationEnv("JWT_JWKS_REFRESH_INTERVAL", time.Hour),
+		RefreshRateLimit:  utils.DurationEnv("JWT_JWKS_REFRESH_RATE_LIMIT", 5*time.Minute),
+		RefreshTimeout:    utils.DurationEnv("JWT_JWKS_REFRESH_TIMEOUT", 10*time.Second),
+		RefreshUnknownKID: utils.BoolEnv("JWT_JWKS_REFRESH_UNKNOWN_KID", true),
+		Issuers:           listEnv("JWT_ISSUERS"),
+		Audiences:         listEnv("JWT_AUDIENCES"),
+		ClockSkew:         utils.DurationEnv("JWT_CLOCK_SKEW", time.Minute),
+	}
+
+	// JWSK_URL is the key set setting the service was first deployed with.
+	if url := os.Getenv("JWSK_URL"); url != "" {
+		config.KeySetURLs = append(config.KeySetURLs, url)
+	}
+
+	return config
+}
+
+// JWTMiddleware verifies the bearer token of every request and stores it in the "user" local.
+func JWTMiddleware(config JWTConfig) (fiber.Handler, error) {
+	middlewareConfig := jwtware.Config{
+		TokenLookup: "header:Authorization",
+		AuthScheme:  "Bearer",
+		Claims:      &Claims{},
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			if err.Error() == "Missing or malformed JWT" {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"message": err.Error(),
+				})
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Invalid or expired JWT",
+			})
+		},
+		SuccessHandler: func(c *fiber.Ctx) error {
+			if err := config.validateClaims(tokenClaims(c)); err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"message": err.Error(),
+				})
+			}
+			return c.Next()
+		},
+	}
+
+	if len(config.KeyFiles) > 0 {
+		keys, err := loadKeyFiles(config.KeyFiles)
+		if err != nil {
+			return nil, err
+		}
+		middlewareConfig.KeyFunc = keys.keyFunc
+	} else if len(config.KeySetURLs) > 0 {
+		middlewareConfig.KeySetURLs = config.KeySetURLs
+		middlewareConfig.KeyRefreshInterval = &config.RefreshInterval
+		middlewareConfig.KeyRefreshRateLimit = &config.RefreshRateLimit
+		middlewareConfig.KeyRefreshTimeout = &config.RefreshTimeout
+		middlewareConfig.KeyRefreshUnknownKID = &config.RefreshUnknownKID
+	} else {
+		return nil, errors.New("no JWT key files or key set URLs configured")
+	}
+
+	return jwtware.New(middlewareConfig), nil
+}
+
+// validateClaims checks the registered time claims with the configured clock skew,
+// and the issuer and audience when accepted values are configured.
+func (config JWTConfig) validateClaims(claims jwt.MapClaims) error {
+	now := time.Now()
+
+	if exp, ok := numericDate(claims["exp"]); ok && now.After(exp.Add(config.ClockSkew)) {
+		return errTokenExpired
+	}
+
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(config.ClockSkew).Before(nbf) {
+		return errTokenNotValidYet
+	}
+
+	if iat, ok := numericDate(claims["iat"]); ok && now.Add(config.ClockSkew).Before(iat) {
+		return errTokenIssuedLater
+	}
+
+	if len(config.Issuers) > 0 {
+		issuer, _ := claims["iss"].(string)
+		if !contains(config.Issuers, issuer) {
+			return errTokenIssuer
+		}
+	}
+
+	if len(config.Audiences) > 0 && !audienceAccepted(claims["aud"], config.Audiences) {
+		return errTokenAudience
+	}
+
+	return nil
+}
+
+func numericDate(value interface{}) (time.Time, bool) {
+	seconds, ok := value.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+func audienceAccepted(claim interface{}, accepted []string) bool {
+	switch audience := claim.(type) {
+	case string:
+		return contains(accepted, audience)
+	case []interface{}:
+		for _, item := range audience {
+			if value, ok := item.(string); ok && contains(accepted, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func listEnv(key string) (values []string) {
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return
+}
+
+func unexpectedKeyError(token *jwt.Token) error {
+	return fmt.Errorf("unexpected jwt key id=%v alg=%v", token.Header["kid"], token.Header["alg"])
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var testSigningKey = []byte("offline-signing-key-for-tests-only")
+
+func jwtApp(t *testing.T, config JWTConfig) *fiber.App {
+	path := filepath.Join(t.TempDir(), "test.json")
+	jwk := `{"kty":"oct","kid":"test","k":"` + base64.RawURLEncoding.EncodeToString(testSigningKey) + `"}`
+	if err := os.WriteFile(path, []byte(jwk), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config.KeyFiles = []string{path}
+
+	middleware, err := JWTMiddleware(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(middleware)
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	return app
+}
+
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(testSigningKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTMiddlewareClaims(t *testing.T) {
+	config := JWTConfig{
+		Issuers:   []string{"https://issuer.example"},
+		Audiences: []string{"products"},
+		ClockSkew: time.Minute,
+	}
+	now := time.Now()
+	valid := func(overrides jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{"iss": "https://issuer.example", "aud": "products", "exp": float64(now.Add(time.Hour).Unix())}
+		for name, value := range overrides {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"valid", valid(nil), fiber.StatusNoContent},
+		{"audience in list", valid(jwt.MapClaims{"aud": []interface{}{"other", "products"}}), fiber.StatusNoContent},
+		{"expired within skew", valid(jwt.MapClaims{"exp": float64(now.Add(-30 * time.Second).Unix())}), fiber.StatusNoContent},
+		{"expired beyond skew", valid(jwt.MapClaims{"exp": float64(now.Add(-2 * time.Minute).Unix())}), fiber.StatusUnauthorized},
+		{"not valid yet", valid(jwt.MapClaims{"nbf": float64(now.Add(2 * time.Minute).Unix())}), fiber.StatusUnauthorized},
+		{"issued in the future", valid(jwt.MapClaims{"iat": float64(now.Add(2 * time.Minute).Unix())}), fiber.StatusUnauthorized},
+		{"wrong issuer", valid(jwt.MapClaims{"iss": "https://other.example"}), fiber.StatusUnauthorized},
+		{"missing issuer", valid(jwt.MapClaims{"iss": nil}), fiber.StatusUnauthorized},
+		{"wrong audience", valid(jwt.MapClaims{"aud": []interface{}{"documents"}}), fiber.StatusUnauthorized},
+	}
+
+	app := jwtApp(t, config)
+	for _, test := range tests {
+		request := httptest.NewRequest(fiber.MethodGet, "/", nil)
+		request.Header.Set(fiber.HeaderAuthorization, "Bearer "+signToken(t, test.claims))
+		response, err := app.Test(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, response.StatusCode, test.status)
+		}
+	}
+}
+
+func TestJWTConfigFromEnv(t *testing.T) {
+	t.Setenv("JWT_ISSUERS", "https://a.example, https://b.example")
+	t.Setenv("JWT_AUDIENCES", "products")
+	t.Setenv("JWT_CLOCK_SKEW", "30s")
+	t.Setenv("JWT_JWKS_URLS", "https://a.example/jwks")
+	t.Setenv("JWSK_URL", "https://legacy.example/jwks")
+
+	config := JWTConfigFromEnv()
+
+	if len(config.Issuers) != 2 || config.Issuers[1] != "https://b.example" {
+		t.Errorf("issuers: got %v", config.Issuers)
+	}
+	if len(config.Audiences) != 1 || config.Audiences[0] != "products" {
+		t.Errorf("audiences: got %v", config.Audiences)
+	}
+	if config.ClockSkew != 30*time.Second {
+		t.Errorf("clock skew: got %s", config.ClockSkew)
+	}
+	if len(config.KeySetURLs) != 2 || config.KeySetURLs[1] != "https://legacy.example/jwks" {
+		t.Errorf("key set urls: got %v", config.KeySetURLs)
+	}
+	if config.RefreshInterval != time.Hour || !config.RefreshUnknownKID {
+		t.Errorf("refresh defaults: got %s, %v", config.RefreshInterval, config.RefreshUnknownKID)
+	}
+}
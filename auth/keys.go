@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// staticKeys maps key ids to verification keys read from files.
+type staticKeys map[string]interface{}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// loadKeyFiles reads PEM public keys, JWKs and JWK sets. A PEM key, or a JWK without kid,
+// is identified by the file name without its extension.
+func loadKeyFiles(paths []string) (staticKeys, error) {
+	keys := staticKeys{}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			err = keys.addJWKs(data, name)
+		} else {
+			err = keys.addPEM(data, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return keys, nil
+}
+
+// keyFunc selects the key by the kid header, or the only key for tokens without kid,
+// and refuses algorithms that do not fit the key type.
+func (keys staticKeys) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := keys[kid]
+	if !ok && kid == "" && len(keys) == 1 {
+		for _, only := range keys {
+			key, ok = only, true
+		}
+	}
+
+	if !ok || !algorithmMatches(token.Method, key) {
+		return nil, unexpectedKeyError(token)
+	}
+	return key, nil
+}
+
+func algorithmMatches(method jwt.SigningMethod, key interface{}) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		_, rsaMethod := method.(*jwt.SigningMethodRSA)
+		_, pssMethod := method.(*jwt.SigningMethodRSAPSS)
+		return rsaMethod || pssMethod
+	case *ecdsa.PublicKey:
+		ecMethod, ok := method.(*jwt.SigningMethodECDSA)
+		return ok && ecMethod.CurveBits == key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		_, ok := method.(*jwt.SigningMethodEd25519)
+		return ok
+	case []byte:
+		_, ok := method.(*jwt.SigningMethodHMAC)
+		return ok
+	default:
+		return false
+	}
+}
+
+func (keys staticKeys) addPEM(data []byte, name string) error {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		keys[name] = key
+		return nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		keys[name] = key
+		return nil
+	}
+	key, err := jwt.ParseEdPublicKeyFromPEM(data)
+	if err != nil {
+		return fmt.Errorf("unsupported PEM public key")
+	}
+	keys[name] = key
+	return nil
+}
+
+func (keys staticKeys) addJWKs(data []byte, name string) error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+
+	if set.Keys == nil {
+		var single jsonWebKey
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+		set.Keys = []jsonWebKey{single}
+	}
+
+	for _, jwk := range set.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return err
+		}
+		kid := jwk.Kid
+		if kid == "" {
+			kid = name
+		}
+		keys[kid] = key
+	}
+	return nil
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported JWK curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported JWK curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 JWK")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(jwk.K)
+	default:
+		return nil, fmt.Errorf("unsupported JWK key type %q", jwk.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	PermissionProductsRead   = "products:read"
+	PermissionProductsWrite  = "products:write"
+	PermissionProductsDelete = "products:delete"
+	PermissionDocumentsRead  = "documents:read"
+	PermissionDocumentsAdmin = "documents:admin"
+	PermissionWebhooksAdmin  = "webhooks:admin"
+	PermissionApiKeysAdmin   = "apikeys:admin"
+)
+
+var (
+	rolePermissionsOnce sync.Once
+	rolePermissions     map[string][]string
+)
+
+// Policy maps "METHOD /path" of the routes of a group to the permission they require.
+type Policy map[string]string
+
+// WithOverrides returns a copy of the policy with entries replaced from a configuration value
+// such as "POST /batchDelete=products:admin;GET /trash=products:read".
+func (policy Policy) WithOverrides(overrides string) Policy {
+	merged := Policy{}
+	for route, permission := range policy {
+		merged[route] = permission
+	}
+
+	for _, entry := range strings.Split(overrides, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		route, permission, found := strings.Cut(entry, "=")
+		if !found || strings.TrimSpace(permission) == "" {
+			log.Println("Invalid route permission override:", entry)
+			continue
+		}
+		merged[strings.Join(strings.Fields(route), " ")] = strings.TrimSpace(permission)
+	}
+
+	return merged
+}
+
+// Require returns a handler rejecting callers without the permission the policy sets for the route.
+// Every route has to be declared, so a route missing from the policy stops the service at startup.
+func (policy Policy) Require(method string, path string) fiber.Handler {
+	permission, ok := policy[method+" "+path]
+	if !ok {
+		panic(fmt.Sprintf("no permission declared for %s %s", method, path))
+	}
+
+	return func(c *fiber.Ctx) error {
+		if !HasPermission(c, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message":    "Missing permission",
+				"permission": permission,
+			})
+		}
+		return c.Next()
+	}
+}
+
+// HasPermission reports whether the token grants the permission, either directly through its
+// scope, scp or permissions claims or through a role mapped to it in ROLE_PERMISSIONS.
+func HasPermission(c *fiber.Ctx, permission string) bool {
+	for _, granted := range Permissions(c) {
+		if permissionMatches(granted, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// MissingPermissions returns the permissions the caller may not pass on, such as to an API key. A wildcard
+// like "*" or "products:*" only counts as held when the caller was granted it or a broader one, and
+// entries containing whitespace are never grantable since they would split into several scopes.
+func MissingPermissions(c *fiber.Ctx, permissions []string) (missing []string) {
+	for _, permission := range permissions {
+		if permission != strings.Join(strings.Fields(permission), "") || !HasPermission(c, permission) {
+			missing = append(missing, permission)
+		}
+	}
+	return
+}
+
+func Permissions(c *fiber.Ctx) (permissions []string) {
+	permissions = append(permissions, claimStrings(c, "scope")...)
+	permissions = append(permissions, claimStrings(c, "scp")...)
+	permissions = append(permissions, claimStrings(c, "permissions")...)
+
+	rolePermissionsOnce.Do(loadRolePermissions)
+	for _, role := range claimStrings(c, "roles") {
+		permissions = append(permissions, rolePermissions[role]...)
+	}
+	return
+}
+
+// permissionMatches accepts an exact grant, "*" and resource wildcards such as "products:*".
+func permissionMatches(granted string, permission string) bool {
+	if granted == "*" || granted == permission {
+		return true
+	}
+	return strings.HasSuffix(granted, ":*") && strings.HasPrefix(permission, strings.TrimSuffix(granted, "*"))
+}
+
+// loadRolePermissions reads ROLE_PERMISSIONS=admin=*;clerk=products:read,products:write.
+func loadRolePermissions() {
+	rolePermissions = map[string][]string{}
+
+	for _, entry := range strings.Split(os.Getenv("ROLE_PERMISSIONS"), ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		role, permissions, found := strings.Cut(entry, "=")
+		if !found {
+			log.Println("Invalid ROLE_PERMISSIONS entry:", entry)
+			continue
+		}
+		for _, permission := range strings.Split(permissions, ",") {
+			if permission = strings.TrimSpace(permission); permission != "" {
+				rolePermissions[strings.TrimSpace(role)] = append(rolePermissions[strings.TrimSpace(role)], permission)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func permissionApp(policy Policy, claims jwt.MapClaims) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user", &jwt.Token{Claims: claims})
+		return c.Next()
+	})
+	app.Delete("/products", policy.Require(fiber.MethodDelete, "/products"), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	return app
+}
+
+func TestPolicyRequire(t *testing.T) {
+	policy := Policy{"DELETE /products": PermissionProductsDelete}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		status int
+	}{
+		{"scope", jwt.MapClaims{"scope": "products:read products:delete"}, fiber.StatusNoContent},
+		{"resource wildcard", jwt.MapClaims{"permissions": []interface{}{"products:*"}}, fiber.StatusNoContent},
+		{"missing permission", jwt.MapClaims{"scope": "products:read products:write"}, fiber.StatusForbidden},
+		{"other resource wildcard", jwt.MapClaims{"scp": "documents:*"}, fiber.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := permissionApp(policy, test.claims).Test(httptest.NewRequest(fiber.MethodDelete, "/products", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != test.status {
+				t.Fatalf("status %d, want %d", response.StatusCode, test.status)
+			}
+			if test.status != fiber.StatusForbidden {
+				return
+			}
+
+			data, _ := io.ReadAll(response.Body)
+			var body map[string]string
+			if err := json.Unmarshal(data, &body); err != nil || body["permission"] != PermissionProductsDelete {
+				t.Errorf("body: got %s", data)
+			}
+		})
+	}
+}
+
+func TestMissingPermissions(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		c.Locals("user", &jwt.Token{Claims: jwt.MapClaims{"scope": "products:* documents:read"}})
+		return c.JSON(MissingPermissions(c, []string{"products:write", "documents:read", "documents:admin", "*", "products:read documents:admin"}))
+	})
+
+	response, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(response.Body)
+	var missing []string
+	_ = json.Unmarshal(data, &missing)
+
+	want := []string{"documents:admin", "*", "products:read documents:admin"}
+	if len(missing) != len(want) {
+		t.Fatalf("got %v, want %v", missing, want)
+	}
+	for i := range want {
+		if missing[i] != want[i] {
+			t.Errorf("got %v, want %v", missing, want)
+		}
+	}
+}
+
+func TestPolicyRequireUndeclaredRoute(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("undeclared route did not panic")
+		}
+	}()
+
+	Policy{"GET /products": PermissionProductsRead}.WithOverrides("POST /products=products:write").Require(fiber.MethodDelete, "/products")
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"os"
+)
+
+type tenantKey struct{}
+
+// TenantMiddleware resolves the tenant of the request from the claim named by TENANT_CLAIM
+// (tenant_id by default), falling back to DEFAULT_TENANT. Requests with neither are rejected,
+// so no repository query runs without a tenant on behalf of a user.
+func TenantMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenant := TenantFromToken(c)
+		if tenant == "" {
+			tenant = os.Getenv("DEFAULT_TENANT")
+		}
+
+		if tenant == "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Token has no tenant",
+			})
+		}
+
+		c.SetUserContext(WithTenant(c.UserContext(), tenant))
+		return c.Next()
+	}
+}
+
+func TenantFromToken(c *fiber.Ctx) string {
+	tenant, _ := tokenClaims(c)[tenantClaim()].(string)
+	return tenant
+}
+
+func tenantClaim() string {
+	if claim := os.Getenv("TENANT_CLAIM"); claim != "" {
+		return claim
+	}
+	return "tenant_id"
+}
+
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+func TenantFromContext(ctx context.Context) (tenant string, ok bool) {
+	tenant, ok = ctx.Value(tenantKey{}).(string)
+	return
+}
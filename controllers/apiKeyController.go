@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"msrd-products/auth"
+	"msrd-products/db"
+	"msrd-products/logic"
+	"msrd-products/models"
+	"msrd-products/utils"
+	"time"
+)
+
+// ListApiKeys godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary list the API keys of the tenant
+// @Accept       json
+// @Produce      json
+// @Success 200 {array} models.ApiKey
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/apiKeys [get]
+func ListApiKeys(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	keyRep := logic.NewApiKeysRepository(c.UserContext(), dbContext)
+
+	apiKeys, err := keyRep.List()
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(apiKeys)
+}
+
+// IssueApiKey godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary issues an API key for service-to-service calls
+// @Description The key is only returned in this response. Callers can only grant scopes they hold themselves.
+// @Accept       json
+// @Produce      json
+// @Param apiKey body models.CreateApiKeyRequest true "New API key"
+// @Success 201 {object} models.IssuedApiKey
+// @Failure 400 {object} nil
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/apiKeys [post]
+func IssueApiKey(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	keyRep := logic.NewApiKeysRepository(c.UserContext(), dbContext)
+
+	var request models.CreateApiKeyRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse body",
+			"error":   err,
+		})
+	}
+
+	valErr := utils.Validate(&request)
+	if valErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to validate body",
+			"error":   valErr,
+		})
+	}
+
+	if rejected, err := rejectUngrantedScopes(c, request.Scopes); rejected {
+		return err
+	}
+
+	if request.ExpiresAt == nil {
+		if ttl := utils.DurationEnv("API_KEY_DEFAULT_TTL", 0); ttl > 0 {
+			expiresAt := time.Now().Add(ttl)
+			request.ExpiresAt = &expiresAt
+		}
+	} else if !request.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "expires_at must be in the future",
+		})
+	}
+
+	issued, err := keyRep.Issue(request)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(issued)
+}
+
+// RotateApiKey godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary replaces an API key with a new one
+// @Description The old key keeps working for API_KEY_ROTATION_GRACE and then expires.
+// @Description Callers can only rotate keys whose scopes they hold themselves.
+// @Accept       json
+// @Produce      json
+// @Param id path string true "API key id"
+// @Success 201 {object} models.IssuedApiKey
+// @Failure 403 {object} nil "Missing permission"
+// @Failure 404 {object} nil
+// @Failure 409 {object} nil "Key has already been rotated"
+// @Router /api/apiKeys/{id}/rotate [post]
+func RotateApiKey(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	keyRep := logic.NewApiKeysRepository(c.UserContext(), dbContext)
+
+	apiKey, err := keyRep.FindById(c.Params("id"))
+
+	if err == logic.ErrApiKeyNotFound {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	if rejected, err := rejectUngrantedScopes(c, apiKey.Scopes); rejected {
+		return err
+	}
+
+	issued, err := keyRep.Rotate(apiKey.Id.Hex(), utils.DurationEnv("API_KEY_ROTATION_GRACE", 24*time.Hour))
+
+	if err == logic.ErrApiKeyNotFound {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if err == logic.ErrApiKeyRotated {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(issued)
+}
+
+// RevokeApiKey godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary revokes an API key
+// @Accept       json
+// @Produce      json
+// @Param id path string true "API key id"
+// @Success 200 {object} models.ApiKey
+// @Failure 403 {object} nil "Missing permission"
+// @Failure 404 {object} nil
+// @Failure 409 {object} nil "Key has already been revoked"
+// @Router /api/apiKeys/{id} [delete]
+func RevokeApiKey(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	keyRep := logic.NewApiKeysRepository(c.UserContext(), dbContext)
+
+	apiKey, err := keyRep.Revoke(c.Params("id"))
+
+	if err == logic.ErrApiKeyNotFound {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if err == logic.ErrApiKeyRevoked {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(apiKey)
+}
+
+// rejectUngrantedScopes responds 403 when a key would carry scopes the caller does not hold,
+// so issuing or rotating keys cannot widen the caller's own permissions.
+func rejectUngrantedScopes(c *fiber.Ctx, scopes []string) (bool, error) {
+	missing := auth.MissingPermissions(c, scopes)
+	if len(missing) == 0 {
+		return false, nil
+	}
+
+	return true, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"message":    "Missing permission",
+		"permission": missing[0],
+	})
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"msrd-products/db"
+	"msrd-products/utils"
+)
+
+// apiKeyApp serves the API key handlers to a caller holding the given scope.
+func apiKeyApp(mt *mtest.T, scope string) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		utils.SetLocal[db.DbContext](c, "db_context", mockDbContext{database: mt.DB})
+		c.Locals("user", &jwt.Token{Claims: jwt.MapClaims{"sub": "caller", "scope": scope}, Valid: true})
+		return c.Next()
+	})
+	app.Post("/api/apiKeys", IssueApiKey)
+	app.Post("/api/apiKeys/:id/rotate", RotateApiKey)
+	app.Delete("/api/apiKeys/:id", RevokeApiKey)
+	return app
+}
+
+func TestIssueApiKeyRejectsUngrantedScopes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name   string
+		scopes string
+	}{
+		{"everything", `["*"]`},
+		{"a permission the caller lacks", `["products:read","documents:read"]`},
+		{"a wider wildcard", `["apikeys:*"]`},
+		{"a scope that splits into a wildcard", `["products:read *"]`},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			request := httptest.NewRequest(fiber.MethodPost, "/api/apiKeys", strings.NewReader(`{"name":"key","scopes":`+test.scopes+`}`))
+			request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+			response, err := apiKeyApp(mt, "products:* apikeys:admin").Test(request)
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if response.StatusCode != fiber.StatusForbidden {
+				mt.Errorf("got status %d, want %d", response.StatusCode, fiber.StatusForbidden)
+			}
+			if events := mt.GetAllStartedEvents(); len(events) != 0 {
+				mt.Errorf("the key was written: %v", events[0].CommandName)
+			}
+		})
+	}
+}
+
+func TestRotateApiKeyRejectsUngrantedScopes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("rotate", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.api_keys", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: id},
+			{Key: "name", Value: "admin key"},
+			{Key: "scopes", Value: bson.A{"*"}},
+		}))
+
+		request := httptest.NewRequest(fiber.MethodPost, "/api/apiKeys/"+id.Hex()+"/rotate", nil)
+		response, err := apiKeyApp(mt, "apikeys:admin").Test(request)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if response.StatusCode != fiber.StatusForbidden {
+			mt.Errorf("got status %d, want %d", response.StatusCode, fiber.StatusForbidden)
+		}
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName != "find" {
+				mt.Errorf("unexpected %s after the scope check", event.CommandName)
+			}
+		}
+	})
+}
+
+func TestRotateApiKeyConflicts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	id := primitive.NewObjectID()
+	stored := func(fields ...bson.E) bson.D {
+		return append(bson.D{
+			{Key: "_id", Value: id},
+			{Key: "name", Value: "key"},
+			{Key: "scopes", Value: bson.A{"products:read"}},
+		}, fields...)
+	}
+
+	tests := []struct {
+		name      string
+		responses []bson.D
+		commands  []string
+	}{
+		{
+			"already rotated",
+			[]bson.D{
+				mtest.CreateCursorResponse(0, "db.api_keys", mtest.FirstBatch, stored(bson.E{Key: "replaced_by", Value: primitive.NewObjectID()})),
+				mtest.CreateCursorResponse(0, "db.api_keys", mtest.FirstBatch, stored(bson.E{Key: "replaced_by", Value: primitive.NewObjectID()})),
+			},
+			[]string{"find", "find"},
+		},
+		{
+			"rotated concurrently",
+			[]bson.D{
+				mtest.CreateCursorResponse(0, "db.api_keys", mtest.FirstBatch, stored()),
+				mtest.CreateCursorResponse(0, "db.api_keys", mtest.FirstBatch, stored()),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			},
+			[]string{"find", "find", "insert", "update", "delete"},
+		},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(test.responses...)
+
+			request := httptest.NewRequest(fiber.MethodPost, "/api/apiKeys/"+id.Hex()+"/rotate", nil)
+			response, err := apiKeyApp(mt, "products:read apikeys:admin").Test(request)
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if response.StatusCode != fiber.StatusConflict {
+				mt.Fatalf("got status %d, want %d", response.StatusCode, fiber.StatusConflict)
+			}
+
+			events := mt.GetAllStartedEvents()
+			if len(events) != len(test.commands) {
+				mt.Fatalf("got %d commands, want %v", len(events), test.commands)
+			}
+			for i, event := range events {
+				if event.CommandName != test.commands[i] {
+					mt.Errorf("command %d: got %s, want %s", i, event.CommandName, test.commands[i])
+				}
+			}
+			if test.name == "rotated concurrently" {
+				filter := events[3].Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+				if _, err := filter.LookupErr("replaced_by"); err != nil {
+					mt.Errorf("update filter %s does not require an unrotated key", filter)
+				}
+			}
+		})
+	}
+}
+
+func TestRevokeApiKey(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	id := primitive.NewObjectID()
+	revoked := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "name", Value: "key"},
+		{Key: "revoked_at", Value: primitive.NewDateTimeFromTime(time.Now().Add(-time.Hour))},
+	}
+
+	tests := []struct {
+		name      string
+		responses []bson.D
+		status    int
+	}{
+		{
+			"live key",
+			[]bson.D{{{Key: "ok", Value: 1}, {Key: "value", Value: revoked}}},
+			fiber.StatusOK,
+		},
+		{
+			"already revoked",
+			[]bson.D{
+				{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+				mtest.CreateCursorResponse(0, "db.api_keys", mtest.FirstBatch, revoked),
+			},
+			fiber.StatusConflict,
+		},
+		{
+			"unknown key",
+			[]bson.D{
+				{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+				mtest.CreateCursorResponse(0, "db.api_keys", mtest.FirstBatch),
+			},
+			fiber.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(test.responses...)
+
+			request := httptest.NewRequest(fiber.MethodDelete, "/api/apiKeys/"+id.Hex(), nil)
+			response, err := apiKeyApp(mt, "apikeys:admin").Test(request)
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if response.StatusCode != test.status {
+				mt.Fatalf("got status %d, want %d", response.StatusCode, test.status)
+			}
+
+			filter := mt.GetStartedEvent().Command.Lookup("query").Document()
+			if value, err := filter.LookupErr("revoked_at"); err != nil || value.Type != bson.TypeNull {
+				mt.Errorf("revoke filter %s does not require a live key", filter)
+			}
+		})
+	}
+}
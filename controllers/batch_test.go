@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"msrd-products/db"
+	"msrd-products/models"
+	"msrd-products/utils"
+)
+
+// createResponses answers the insert, the read back and the history entry of a created product.
+func createResponses(name string) []bson.D {
+	return []bson.D{
+		mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "name", Value: name},
+			{Key: "version", Value: int64(1)},
+		}),
+		mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+	}
+}
+
+// staleUpdateResponses answers an update whose version no longer matches the stored product.
+func staleUpdateResponses(id primitive.ObjectID) []bson.D {
+	return []bson.D{
+		{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+		mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: id},
+			{Key: "name", Value: "current"},
+			{Key: "version", Value: int64(3)},
+		}),
+	}
+}
+
+func runBatch(mt *mtest.T, body string, transactions *[]error) (int, models.BatchResponse) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		utils.SetLocal[db.DbContext](c, "db_context", mockDbContext{database: mt.DB, transactions: transactions})
+		return c.Next()
+	})
+	app.Post("/api/products/batch", BatchProducts)
+
+	request := httptest.NewRequest(fiber.MethodPost, "/api/products/batch", strings.NewReader(body))
+	request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	response, err := app.Test(request)
+	if err != nil {
+		mt.Fatal(err)
+	}
+
+	data, _ := io.ReadAll(response.Body)
+	var result models.BatchResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		mt.Fatalf("status %d: %s", response.StatusCode, data)
+	}
+	return response.StatusCode, result
+}
+
+func resultStatuses(response models.BatchResponse) (statuses []int) {
+	for _, result := range response.Results {
+		statuses = append(statuses, result.Status)
+	}
+	return
+}
+
+func TestBatchProducts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	stale := primitive.NewObjectID()
+	operations := `[
+		{"op":"create","name":"first"},
+		{"op":"update","id":"` + stale.Hex() + `","version":1,"name":"renamed"},
+		{"op":"create","name":"last"}
+	]`
+
+	mt.Run("atomic batch rolls back on the first failure", func(mt *mtest.T) {
+		mt.AddMockResponses(append(createResponses("first"), staleUpdateResponses(stale)...)...)
+
+		var transactions []error
+		status, response := runBatch(mt, `{"mode":"atomic","operations":`+operations+`}`, &transactions)
+
+		// Without a real session every write runs its own transaction; the batch's ends last.
+		if len(transactions) == 0 || transactions[len(transactions)-1] == nil {
+			mt.Fatalf("got transactions %v, want the batch transaction aborted", transactions)
+		}
+		if status != fiber.StatusConflict || response.Committed {
+			mt.Fatalf("status %d, committed %v", status, response.Committed)
+		}
+		statuses := resultStatuses(response)
+		want := []int{fiber.StatusFailedDependency, fiber.StatusPreconditionFailed, fiber.StatusFailedDependency}
+		if len(statuses) != len(want) || statuses[0] != want[0] || statuses[1] != want[1] || statuses[2] != want[2] {
+			mt.Fatalf("statuses %v, want %v", statuses, want)
+		}
+		if response.Results[0].Error != "rolled back" || response.Results[0].Product != nil {
+			mt.Errorf("first result: %+v", response.Results[0])
+		}
+		if response.Results[2].Error != "not attempted" || response.Results[2].Index != 2 {
+			mt.Errorf("last result: %+v", response.Results[2])
+		}
+
+		inserts := 0
+		for _, event := range mt.GetAllStartedEvents() {
+			if event.CommandName == "insert" && event.Command.Lookup("insert").StringValue() == "products" {
+				inserts++
+			}
+		}
+		if inserts != 1 {
+			mt.Errorf("got %d product inserts, want only the one before the failure", inserts)
+		}
+	})
+
+	mt.Run("best-effort batch reports partial failure", func(mt *mtest.T) {
+		responses := createResponses("first")
+		responses = append(responses, staleUpdateResponses(stale)...)
+		responses = append(responses, createResponses("last")...)
+		mt.AddMockResponses(responses...)
+
+		status, response := runBatch(mt, `{"mode":"bestEffort","operations":`+operations+`}`, nil)
+
+		if status != fiber.StatusMultiStatus || !response.Committed {
+			mt.Fatalf("status %d, committed %v", status, response.Committed)
+		}
+		statuses := resultStatuses(response)
+		want := []int{fiber.StatusCreated, fiber.StatusPreconditionFailed, fiber.StatusCreated}
+		if len(statuses) != len(want) || statuses[0] != want[0] || statuses[1] != want[1] || statuses[2] != want[2] {
+			mt.Fatalf("statuses %v, want %v", statuses, want)
+		}
+		if response.Results[0].Product == nil || response.Results[2].Product == nil || response.Results[1].Product != nil {
+			mt.Errorf("results: %+v", response.Results)
+		}
+	})
+
+	mt.Run("batch without failures", func(mt *mtest.T) {
+		mt.AddMockResponses(createResponses("only")...)
+
+		status, response := runBatch(mt, `{"operations":[{"op":"create","name":"only"}]}`, nil)
+
+		if status != fiber.StatusOK || !response.Committed || response.Mode != models.BatchModeAtomic {
+			mt.Fatalf("status %d: %+v", status, response)
+		}
+	})
+}
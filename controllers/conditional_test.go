@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"msrd-products/db"
+	"msrd-products/utils"
+)
+
+func conditionalApp(mt *mtest.T) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		utils.SetLocal[db.DbContext](c, "db_context", mockDbContext{database: mt.DB})
+		return c.Next()
+	})
+	app.Post("/api/products/query", QueryProducts)
+	app.Get("/api/products/:id", GetProduct)
+	return app
+}
+
+func conditionalRequest(mt *mtest.T, request *http.Request, headers map[string]string) *http.Response {
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	response, err := conditionalApp(mt).Test(request)
+	if err != nil {
+		mt.Fatal(err)
+	}
+	return response
+}
+
+func TestGetProductConditional(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	id := primitive.NewObjectID()
+	updatedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	stored := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "name", Value: "product"},
+		{Key: "updated_at", Value: updatedAt},
+		{Key: "version", Value: int64(7)},
+	}
+	path := "/api/products/" + id.Hex()
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"no validators", nil, fiber.StatusOK},
+		{"matching If-None-Match", map[string]string{fiber.HeaderIfNoneMatch: `"7"`}, fiber.StatusNotModified},
+		{"stale If-None-Match", map[string]string{fiber.HeaderIfNoneMatch: `"6"`}, fiber.StatusOK},
+		{"If-Modified-Since at the last change", map[string]string{fiber.HeaderIfModifiedSince: updatedAt.Format(http.TimeFormat)}, fiber.StatusNotModified},
+		{"If-Modified-Since before the last change", map[string]string{fiber.HeaderIfModifiedSince: updatedAt.Add(-time.Second).Format(http.TimeFormat)}, fiber.StatusOK},
+		{
+			"stale If-None-Match wins over If-Modified-Since",
+			map[string]string{fiber.HeaderIfNoneMatch: `"6"`, fiber.HeaderIfModifiedSince: updatedAt.Format(http.TimeFormat)},
+			fiber.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, stored))
+
+			response := conditionalRequest(mt, httptest.NewRequest(fiber.MethodGet, path, nil), test.headers)
+
+			if response.StatusCode != test.status {
+				mt.Fatalf("status %d, want %d", response.StatusCode, test.status)
+			}
+			if etag := response.Header.Get(fiber.HeaderETag); etag != `"7"` {
+				mt.Errorf("ETag: got %s", etag)
+			}
+			if lastModified := response.Header.Get(fiber.HeaderLastModified); lastModified != updatedAt.Format(http.TimeFormat) {
+				mt.Errorf("Last-Modified: got %s", lastModified)
+			}
+		})
+	}
+
+	mt.Run("pending quantities", func(mt *mtest.T) {
+		pending := func(incoming string) bson.D {
+			in, _ := primitive.ParseDecimal128(incoming)
+			out, _ := primitive.ParseDecimal128("0")
+			return mtest.CreateCursorResponse(0, "db.document_lines", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: id},
+				{Key: "incoming", Value: in},
+				{Key: "outgoing", Value: out},
+			})
+		}
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, stored), pending("5"))
+		response := conditionalRequest(mt, httptest.NewRequest(fiber.MethodGet, path+"?includePending=true", nil), nil)
+		etag := response.Header.Get(fiber.HeaderETag)
+		if response.StatusCode != fiber.StatusOK || !strings.HasPrefix(etag, "W/") || response.Header.Get(fiber.HeaderLastModified) != "" {
+			mt.Fatalf("status %d, ETag %s, Last-Modified %s", response.StatusCode, etag, response.Header.Get(fiber.HeaderLastModified))
+		}
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, stored), pending("5"))
+		response = conditionalRequest(mt, httptest.NewRequest(fiber.MethodGet, path+"?includePending=true", nil), map[string]string{fiber.HeaderIfNoneMatch: etag})
+		if response.StatusCode != fiber.StatusNotModified {
+			mt.Errorf("unchanged pending quantities: status %d", response.StatusCode)
+		}
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, stored), pending("8"))
+		response = conditionalRequest(mt, httptest.NewRequest(fiber.MethodGet, path+"?includePending=true", nil), map[string]string{fiber.HeaderIfNoneMatch: etag})
+		if response.StatusCode != fiber.StatusOK {
+			mt.Errorf("changed pending quantities: status %d", response.StatusCode)
+		}
+	})
+}
+
+func TestQueryProductsConditional(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	updatedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	deletedAt := updatedAt.Add(time.Hour)
+	product := bson.D{
+		{Key: "_id", Value: primitive.NewObjectID()},
+		{Key: "name", Value: "product"},
+		{Key: "updated_at", Value: updatedAt},
+		{Key: "version", Value: int64(2)},
+	}
+	body := `{"rows":10}`
+
+	// query answers the find and count of a page holding the product, and the latest history entry.
+	query := func(mt *mtest.T, latestChange time.Time, headers map[string]string) *http.Response {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, product),
+			mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, bson.D{{Key: "n", Value: int64(1)}}),
+			mtest.CreateCursorResponse(0, "db.product_history", mtest.FirstBatch, bson.D{{Key: "timestamp", Value: latestChange}}),
+		)
+		request := httptest.NewRequest(fiber.MethodPost, "/api/products/query", strings.NewReader(body))
+		request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return conditionalRequest(mt, request, headers)
+	}
+
+	mt.Run("If-None-Match", func(mt *mtest.T) {
+		first := query(mt, updatedAt, nil)
+		etag := first.Header.Get(fiber.HeaderETag)
+		if first.StatusCode != fiber.StatusOK || etag == "" || strings.HasPrefix(etag, "W/") {
+			mt.Fatalf("status %d, ETag %q", first.StatusCode, etag)
+		}
+
+		if response := query(mt, updatedAt, map[string]string{fiber.HeaderIfNoneMatch: etag}); response.StatusCode != fiber.StatusNotModified {
+			mt.Errorf("unchanged page: status %d", response.StatusCode)
+		}
+		if response := query(mt, updatedAt, map[string]string{fiber.HeaderIfNoneMatch: `"other"`}); response.StatusCode != fiber.StatusOK {
+			mt.Errorf("other ETag: status %d", response.StatusCode)
+		}
+	})
+
+	mt.Run("If-Modified-Since", func(mt *mtest.T) {
+		first := query(mt, updatedAt, nil)
+		lastModified := first.Header.Get(fiber.HeaderLastModified)
+		if lastModified != updatedAt.Format(http.TimeFormat) {
+			mt.Fatalf("Last-Modified: got %q", lastModified)
+		}
+
+		if response := query(mt, updatedAt, map[string]string{fiber.HeaderIfModifiedSince: lastModified}); response.StatusCode != fiber.StatusNotModified {
+			mt.Errorf("unchanged collection: status %d", response.StatusCode)
+		}
+
+		// Another product was deleted after the cached response; the page itself looks the same.
+		response := query(mt, deletedAt, map[string]string{fiber.HeaderIfModifiedSince: lastModified})
+		if response.StatusCode != fiber.StatusOK {
+			mt.Errorf("after a deletion: status %d", response.StatusCode)
+		}
+		if got := response.Header.Get(fiber.HeaderLastModified); got != deletedAt.Format(http.TimeFormat) {
+			mt.Errorf("Last-Modified after a deletion: got %q", got)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"msrd-products/db"
+	"msrd-products/logic"
+	"msrd-products/models"
+	"msrd-products/utils"
+)
+
+// GetDocument godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary get one document by id
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Document id"
+// @Success 200 {object} models.Document
+// @Failure 403 {object} nil "Missing permission"
+// @Failure 404 {object} nil
+// @Router /api/documents/{id} [get]
+func GetDocument(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	docRep := logic.NewDocumentsRepository(c.UserContext(), dbContext)
+
+	document, err := docRep.FindById(c.Params("id"))
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	if document == nil {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(document)
+}
+
+// QueryDocuments godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary query documents
+// @Description Documents can be filtered by status and by the time their status last changed (updatedFrom inclusive, updatedTo exclusive).
+// @Accept       json
+// @Produce      json
+// @Param queryRequest body models.DocumentQueryRequest true "Query documents"
+// @Success 200 {object} models.QueryResponse[models.Document]
+// @Failure 400 {object} nil
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/documents/query [post]
+func QueryDocuments(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	docRep := logic.NewDocumentsRepository(c.UserContext(), dbContext)
+
+	var queryRequest models.DocumentQueryRequest
+
+	if err := c.BodyParser(&queryRequest); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse body",
+			"error":   err,
+		})
+	}
+
+	valErr := utils.Validate(&queryRequest)
+	if valErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to validate body",
+			"error":   valErr,
+		})
+	}
+
+	err, queryResult := docRep.QueryDocuments(queryRequest)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(queryResult)
+}
+
+// GetDocumentStatusSummary godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary count documents per status
+// @Accept       json
+// @Produce      json
+// @Param status query string false "Only count documents with this status"
+// @Param updatedFrom query string false "Only count documents whose status changed at or after this RFC 3339 time"
+// @Param updatedTo query string false "Only count documents whose status changed before this RFC 3339 time"
+// @Success 200 {array} models.DocumentStatusCount
+// @Failure 400 {object} nil
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/documents/summary [get]
+func GetDocumentStatusSummary(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	docRep := logic.NewDocumentsRepository(c.UserContext(), dbContext)
+
+	filter := models.DocumentFilter{Status: c.Query("status")}
+
+	var err error
+	if filter.UpdatedFrom, err = timeParam(c, "updatedFrom"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	if filter.UpdatedTo, err = timeParam(c, "updatedTo"); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	summary, err := docRep.StatusSummary(filter)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(summary)
+}
+
+// GetDocumentStatusHistory godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary list the status changes of a document, oldest first
+// @Description Changes flagged as illegal were received but not applied.
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Document id"
+// @Success 200 {array} models.DocumentStatusChange
+// @Failure 403 {object} nil "Missing permission"
+// @Failure 404 {object} nil
+// @Router /api/documents/{id}/status-history [get]
+func GetDocumentStatusHistory(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	docRep := logic.NewDocumentsRepository(c.UserContext(), dbContext)
+
+	history, err := docRep.StatusHistory(c.Params("id"))
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	if history == nil {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(history)
+}
+
+// GetDocumentLines godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary list the product lines of a document
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Document id"
+// @Success 200 {array} models.DocumentLine
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/documents/{id}/lines [get]
+func GetDocumentLines(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	lineRep := logic.NewDocumentLinesRepository(c.UserContext(), dbContext)
+
+	lines, err := lineRep.FindByDocument(c.Params("id"))
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(lines)
+}
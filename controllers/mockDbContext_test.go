@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"msrd-products/db"
+)
+
+// mockDbContext serves the collections a test needs from a mocked deployment.
+type mockDbContext struct {
+	db.DbContext
+	database *mongo.Database
+	// transactions, when set, collects the result of every transaction; an error means it was aborted.
+	transactions *[]error
+}
+
+// WithTransaction runs fn right away, since the mocked deployment answers commands one by one.
+func (m mockDbContext) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	if m.transactions != nil {
+		*m.transactions = append(*m.transactions, err)
+	}
+	return err
+}
+
+func (m mockDbContext) GetProductsCollection() *mongo.Collection {
+	return m.database.Collection("products")
+}
+
+func (m mockDbContext) GetProductHistoryCollection() *mongo.Collection {
+	return m.database.Collection("product_history")
+}
+
+func (m mockDbContext) GetApiKeysCollection() *mongo.Collection {
+	return m.database.Collection("api_keys")
+}
+
+func (m mockDbContext) GetDocumentsCollection() *mongo.Collection {
+	return m.database.Collection("documents")
+}
+
+func (m mockDbContext) GetDocumentLinesCollection() *mongo.Collection {
+	return m.database.Collection("document_lines")
+}
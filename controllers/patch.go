@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"msrd-products/models"
+	"msrd-products/utils"
+	"reflect"
+	"strings"
+)
+
+const (
+	mimeMergePatch = "application/merge-patch+json"
+	mimeJSONPatch  = "application/json-patch+json"
+)
+
+var errUnsupportedPatchType = errors.New("content type must be " + mimeMergePatch + " or " + mimeJSONPatch)
+
+// patchableDocument renders the mutable fields of a product as a generic JSON document.
+func patchableDocument(product *models.Product) (map[string]interface{}, error) {
+	data, err := json.Marshal(models.PatchProductRequest{
+		Name:        product.Name,
+		Description: product.Description,
+		Unit:        product.Unit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+	err = json.Unmarshal(data, &document)
+	return document, err
+}
+
+// applyPatch applies the request body according to its content type
+// and reports the top-level fields the patch touches.
+func applyPatch(c *fiber.Ctx, document map[string]interface{}) (interface{}, []string, error) {
+	contentType := strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0])
+
+	switch contentType {
+	case mimeMergePatch:
+		var patch interface{}
+		if err := json.Unmarshal(c.Body(), &patch); err != nil {
+			return nil, nil, err
+		}
+		return utils.MergePatch(document, patch), utils.MergePatchFields(patch), nil
+	case mimeJSONPatch:
+		var operations []utils.PatchOperation
+		if err := json.Unmarshal(c.Body(), &operations); err != nil {
+			return nil, nil, err
+		}
+		fields := utils.JSONPatchFields(operations)
+		patched, err := utils.ApplyJSONPatch(document, operations)
+		return patched, fields, err
+	default:
+		return nil, nil, errUnsupportedPatchType
+	}
+}
+
+func decodePatched(document map[string]interface{}, request *models.PatchProductRequest) error {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(request)
+}
+
+// patchChanges turns the difference between the original and the patched document into
+// a targeted $set of changed fields and an $unset of removed ones.
+func patchChanges(original map[string]interface{}, patched map[string]interface{}) (set bson.M, unset []string) {
+	set = bson.M{}
+	for field, documentField := range models.ProductPatchableFields {
+		before, hadBefore := original[field]
+		after, hasAfter := patched[field]
+
+		if !hasAfter {
+			if hadBefore {
+				unset = append(unset, documentField)
+			}
+			continue
+		}
+
+		if !hadBefore || !reflect.DeepEqual(before, after) {
+			set[documentField] = after
+		}
+	}
+	return
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"msrd-products/db"
+	"msrd-products/utils"
+)
+
+func TestPatchProductPersistsChanges(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"merge patch", mimeMergePatch, `{"name":"new name","unit":null}`},
+		{"JSON patch", mimeJSONPatch, `[{"op":"replace","path":"/name","value":"new name"},{"op":"remove","path":"/unit"}]`},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			id := primitive.NewObjectID()
+			stored := bson.D{
+				{Key: "_id", Value: id},
+				{Key: "name", Value: "old name"},
+				{Key: "description", Value: "description"},
+				{Key: "unit", Value: "kg"},
+				{Key: "version", Value: int64(3)},
+			}
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, stored),
+				bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: stored}},
+				mtest.CreateSuccessResponse(),
+			)
+
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				utils.SetLocal[db.DbContext](c, "db_context", mockDbContext{database: mt.DB})
+				return c.Next()
+			})
+			app.Patch("/api/products/:id", PatchProduct)
+
+			request := httptest.NewRequest(fiber.MethodPatch, "/api/products/"+id.Hex(), strings.NewReader(test.body))
+			request.Header.Set(fiber.HeaderContentType, test.contentType)
+			request.Header.Set(fiber.HeaderIfMatch, utils.VersionETag(3))
+
+			response, err := app.Test(request)
+			if err != nil {
+				mt.Fatal(err)
+			}
+			body, _ := io.ReadAll(response.Body)
+			if response.StatusCode != fiber.StatusOK {
+				mt.Fatalf("status %d: %s", response.StatusCode, body)
+			}
+
+			var update bson.Raw
+			for _, event := range mt.GetAllStartedEvents() {
+				if event.CommandName == "findAndModify" {
+					update = event.Command.Lookup("update").Document()
+				}
+			}
+			if update == nil {
+				mt.Fatal("the patch was not written")
+			}
+			if name := update.Lookup("$set", "name").StringValue(); name != "new name" {
+				mt.Errorf("$set name: got %q", name)
+			}
+			if _, err := update.LookupErr("$unset", "unit"); err != nil {
+				mt.Errorf("unit is not unset: %s", update)
+			}
+
+			var product map[string]interface{}
+			_ = json.Unmarshal(body, &product)
+			if product["name"] != "new name" || product["unit"] != "" {
+				mt.Errorf("response: %s", body)
+			}
+		})
+	}
+}
@@ -1,12 +1,18 @@
 package controllers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"log"
+	"msrd-products/auth"
 	"msrd-products/db"
 	"msrd-products/logic"
 	"msrd-products/models"
 	"msrd-products/utils"
+	"time"
 )
 
 // QueryProducts godoc
@@ -15,14 +21,25 @@ import (
 // @Accept       json
 // @Produce      json
 // @Param queryRequest body models.QueryRequest true "Query products"
+// @Param includeDeleted query bool false "Include soft-deleted products (needs the permission to view the trash)"
+// @Param asOf query string false "Return products as they were at this RFC 3339 time"
+// @Param includePending query bool false "Add quantities pending on documents that are not finalized (not with asOf); such results carry no Last-Modified"
+// @Param If-None-Match header string false "ETag of a cached result"
+// @Param If-Modified-Since header string false "Last-Modified of a cached result"
 // @Success 200 {object} models.QueryResponse[models.Product]
+// @Header 200 {string} ETag "Fingerprint of the result page"
+// @Header 200 {string} Last-Modified "Time of the last change of any product, including deletions"
+// @Success 304 {object} nil "Result has not changed"
+// @Failure 400 {object} nil
+// @Failure 403 {object} nil
+// @Failure 422 {object} nil "Too many products to reconstruct for asOf"
 // @Router /api/products/query [post]
 func QueryProducts(c *fiber.Ctx) error {
 	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
 	if dbContext == nil {
 		return c.Status(fiber.StatusInternalServerError).Send(nil)
 	}
-	prodRep := logic.NewProductsRepository(c.Context(), dbContext)
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
 
 	var queryRequest models.QueryRequest
 
@@ -42,13 +59,63 @@ func QueryProducts(c *fiber.Ctx) error {
 		})
 	}
 
-	err, queryResult := prodRep.QueryProducts(queryRequest)
+	includeDeleted, err := includeDeletedParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	asOf, err := asOfParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	includePending, err := includePendingParam(c, asOf)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	err, queryResult := prodRep.QueryProducts(queryRequest, readOptions(includeDeleted, asOf)...)
+
+	if err == logic.ErrAsOfQueryTooBroad {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).Send(nil)
 	}
 
-	return c.Status(fiber.StatusOK).JSON(queryResult)
+	if includePending {
+		products := make([]*models.Product, len(queryResult.Result))
+		for i := range queryResult.Result {
+			products[i] = &queryResult.Result[i]
+		}
+		if err := logic.AttachPendingQuantities(c.UserContext(), dbContext, products); err != nil {
+			return c.Status(fiber.StatusInternalServerError).Send(nil)
+		}
+	}
+
+	// Pending quantities change with document lines, which the product history does not record.
+	var lastModified time.Time
+	if !includePending {
+		lastModified, err = queryLastModified(c, dbContext, queryResult, asOf)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).Send(nil)
+		}
+	}
+
+	if utils.NotModified(c, queryETag(c, queryResult), lastModified) {
+		return c.Status(fiber.StatusNotModified).Send(nil)
+	}
+
+	return sendProducts(c, fiber.StatusOK, queryResult, queriedProducts)
 }
 
 // GetProduct godoc
@@ -57,18 +124,55 @@ func QueryProducts(c *fiber.Ctx) error {
 // @Accept       json
 // @Produce      json
 // @Param id path string true "Product id"
+// @Param includeDeleted query bool false "Return the product even if soft-deleted (needs the permission to view the trash)"
+// @Param asOf query string false "Return the product as it was at this RFC 3339 time"
+// @Param includePending query bool false "Add quantities pending on documents that are not finalized (not with asOf); the ETag is then weak and there is no Last-Modified"
+// @Param If-None-Match header string false "ETag of a cached representation"
+// @Param If-Modified-Since header string false "Last-Modified of a cached representation"
 // @Success 200 {object} models.Product
+// @Header 200 {string} ETag "Product version"
+// @Header 200 {string} Last-Modified "Time of the last product change"
+// @Success 304 {object} nil "Product has not changed"
+// @Failure 400 {object} nil
+// @Failure 403 {object} nil
+// @Failure 404 {object} nil
+// @Failure 410 {object} nil "Product is deleted"
 // @Router /api/products/{id} [get]
 func GetProduct(c *fiber.Ctx) error {
 	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
 	if dbContext == nil {
 		return c.Status(fiber.StatusInternalServerError).Send(nil)
 	}
-	prodRep := logic.NewProductsRepository(c.Context(), dbContext)
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
 
 	id := c.Params("id")
 
-	product, err := prodRep.FindById(id)
+	includeDeleted, err := includeDeletedParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	asOf, err := asOfParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	includePending, err := includePendingParam(c, asOf)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	product, err := prodRep.FindById(id, readOptions(includeDeleted, asOf)...)
+
+	if err == logic.ErrProductDeleted {
+		return c.Status(fiber.StatusGone).Send(nil)
+	}
 
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).Send(nil)
@@ -78,23 +182,42 @@ func GetProduct(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).Send(nil)
 	}
 
-	return c.Status(fiber.StatusOK).JSON(product)
+	// Pending quantities change without a new product version, so they are part of the ETag and
+	// If-Modified-Since cannot be answered.
+	if includePending {
+		if err := logic.AttachPendingQuantities(c.UserContext(), dbContext, []*models.Product{product}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).Send(nil)
+		}
+		if utils.NotModified(c, pendingETag(product), time.Time{}) {
+			return c.Status(fiber.StatusNotModified).Send(nil)
+		}
+		return sendProducts(c, fiber.StatusOK, product, singleProduct)
+	}
+
+	if utils.NotModified(c, utils.VersionETag(product.Version), product.UpdatedAt) {
+		return c.Status(fiber.StatusNotModified).Send(nil)
+	}
+
+	return sendProducts(c, fiber.StatusOK, product, singleProduct)
 }
 
 // AddProduct godoc
 // @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param Idempotency-Key header string false "Makes retries of this request safe"
 // @Summary creates a product record
 // @Accept       json
 // @Produce      json
 // @Param product body models.CreateProductRequest true "New product"
 // @Success 200 {object} models.Product
+// @Failure 409 {object} nil "Another product uses the same name"
+// @Failure 403 {object} nil "Missing permission, or fields the caller may not write"
 // @Router /api/products [post]
 func AddProduct(c *fiber.Ctx) error {
 	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
 	if dbContext == nil {
 		return c.Status(fiber.StatusInternalServerError).Send(nil)
 	}
-	prodRep := logic.NewProductsRepository(c.Context(), dbContext)
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
 
 	var product models.CreateProductRequest
 
@@ -114,31 +237,62 @@ func AddProduct(c *fiber.Ctx) error {
 		})
 	}
 
+	if rejected, err := rejectProtectedFields(c, changedProductFields(nil, product.Name, product.Description, &product.Unit)); rejected {
+		return err
+	}
+
 	newProduct, err := prodRep.Insert(product)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Failed to validate body",
-			"error":   valErr,
+	if err == logic.ErrUniqueKeyConflict {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": err.Error(),
 		})
 	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
 
-	return c.Status(fiber.StatusOK).JSON(newProduct)
+	c.Set(fiber.HeaderETag, utils.VersionETag(newProduct.Version))
+	return sendProducts(c, fiber.StatusOK, newProduct, singleProduct)
 }
 
 // UpdateProduct godoc
 // @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param Idempotency-Key header string false "Makes retries of this request safe"
 // @Summary updates a product record
 // @Accept       json
 // @Produce      json
+// @Param If-Match header string true "ETag of the product version being updated"
 // @Param product body models.UpdateProductRequest true "Product to update"
 // @Success 200 {object} models.Product
+// @Header 200 {string} ETag "New product version"
+// @Failure 404 {object} nil
+// @Failure 409 {object} nil "Another product uses the same name"
+// @Failure 410 {object} nil "Product is deleted"
+// @Failure 412 {object} nil "Product has been modified since the given version"
+// @Failure 428 {object} nil "If-Match header is missing"
+// @Failure 403 {object} nil "Missing permission, or fields the caller may not write"
 // @Router /api/products [put]
 func UpdateProduct(c *fiber.Ctx) error {
 	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
 	if dbContext == nil {
 		return c.Status(fiber.StatusInternalServerError).Send(nil)
 	}
-	prodRep := logic.NewProductsRepository(c.Context(), dbContext)
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
+
+	ifMatch := c.Get(fiber.HeaderIfMatch)
+	if ifMatch == "" {
+		return c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+			"message": "If-Match header is required",
+		})
+	}
+
+	version, err := utils.ParseVersionETag(ifMatch)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse If-Match header",
+			"error":   err.Error(),
+		})
+	}
 
 	var product models.UpdateProductRequest
 
@@ -158,15 +312,47 @@ func UpdateProduct(c *fiber.Ctx) error {
 		})
 	}
 
-	updatedProduct, err := prodRep.Update(product)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": "Failed to validate body",
-			"error":   valErr,
+	// A missing or deleted product is reported by Update below.
+	if productFieldPermissions().Guarded() {
+		current, err := prodRep.FindById(product.Id.Hex())
+		if err != nil && err != logic.ErrProductDeleted {
+			return c.Status(fiber.StatusInternalServerError).Send(nil)
+		}
+		if current != nil {
+			if rejected, err := rejectProtectedFields(c, changedProductFields(current, product.Name, product.Description, product.Unit)); rejected {
+				return err
+			}
+		}
+	}
+
+	updatedProduct, err := prodRep.Update(product, version)
+
+	if err == logic.ErrProductNotFound {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if err == logic.ErrProductDeleted {
+		return c.Status(fiber.StatusGone).Send(nil)
+	}
+
+	if err == logic.ErrVersionMismatch {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if err == logic.ErrUniqueKeyConflict {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": err.Error(),
 		})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(updatedProduct)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	c.Set(fiber.HeaderETag, utils.VersionETag(updatedProduct.Version))
+	return sendProducts(c, fiber.StatusOK, updatedProduct, singleProduct)
 }
 
 // DeleteProduct godoc
@@ -176,18 +362,25 @@ func UpdateProduct(c *fiber.Ctx) error {
 // @Produce      json
 // @Param id path string true "Product id"
 // @Success 200 {object} nil
+// @Failure 404 {object} nil
+// @Failure 403 {object} nil "Missing permission"
 // @Router /api/products/{id} [delete]
 func DeleteProduct(c *fiber.Ctx) error {
 	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
 	if dbContext == nil {
 		return c.Status(fiber.StatusInternalServerError).Send(nil)
 	}
-	prodRep := logic.NewProductsRepository(c.Context(), dbContext)
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
 
 	id := c.Params("id")
 
 	err := prodRep.SoftDeleteById(id)
-	if err != nil {
+
+	if err == logic.ErrProductNotFound {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if err != nil && err != logic.ErrProductDeleted {
 		return c.Status(fiber.StatusInternalServerError).Send(nil)
 	}
 
@@ -196,18 +389,20 @@ func DeleteProduct(c *fiber.Ctx) error {
 
 // BatchDeleteProduct godoc
 // @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param Idempotency-Key header string false "Makes retries of this request safe"
 // @Summary batch delete of products
 // @Accept       json
 // @Produce      json
 // @Param queryRequest body []string true "Product ids"
-// @Success 200 {object} nil
+// @Success 200 {object} models.BatchDeleteResponse
+// @Failure 403 {object} nil "Missing permission"
 // @Router /api/products/batchDelete [post]
 func BatchDeleteProduct(c *fiber.Ctx) error {
 	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
 	if dbContext == nil {
 		return c.Status(fiber.StatusInternalServerError).Send(nil)
 	}
-	prodRep := logic.NewProductsRepository(c.Context(), dbContext)
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
 
 	var ids []string
 
@@ -219,10 +414,531 @@ func BatchDeleteProduct(c *fiber.Ctx) error {
 		})
 	}
 
-	err := prodRep.SoftBatchDeleteById(ids)
+	result, err := prodRep.SoftBatchDeleteById(ids)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).Send(nil)
 	}
 
-	return c.Status(fiber.StatusOK).Send(nil)
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// QueryTrash godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary query soft-deleted products
+// @Accept       json
+// @Produce      json
+// @Param rows query int true "Rows per page"
+// @Param offset query int false "Rows to skip"
+// @Param sortField query string false "Sort field"
+// @Param sortOrder query int false "Sort order" Enums(-1, 0, 1)
+// @Success 200 {object} models.QueryResponse[models.Product]
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/products/trash [get]
+func QueryTrash(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
+
+	var queryRequest models.QueryRequest
+
+	if err := c.QueryParser(&queryRequest); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse query",
+			"error":   err,
+		})
+	}
+
+	valErr := utils.Validate(&queryRequest)
+	if valErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to validate query",
+			"error":   valErr,
+		})
+	}
+
+	err, queryResult := prodRep.QueryTrash(queryRequest)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return sendProducts(c, fiber.StatusOK, queryResult, queriedProducts)
+}
+
+// GetProductHistory godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary page through the change history of a product
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Product id"
+// @Param rows query int true "Rows per page"
+// @Param offset query int false "Rows to skip"
+// @Param sortField query string false "Sort field"
+// @Param sortOrder query int false "Sort order" Enums(-1, 0, 1)
+// @Param field query string false "Only entries changing this field"
+// @Param actor query string false "Only entries made by this actor id"
+// @Success 200 {object} models.QueryResponse[models.ProductHistoryEntry]
+// @Failure 404 {object} nil
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/products/{id}/history [get]
+func GetProductHistory(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
+	historyRep := logic.NewProductHistoryRepository(c.UserContext(), dbContext)
+
+	var queryRequest models.HistoryQueryRequest
+
+	if err := c.QueryParser(&queryRequest); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse query",
+			"error":   err,
+		})
+	}
+
+	valErr := utils.Validate(&queryRequest)
+	if valErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to validate query",
+			"error":   valErr,
+		})
+	}
+
+	product, err := prodRep.FindById(c.Params("id"), logic.IncludeDeleted(true))
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	if product == nil {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	err, history := historyRep.QueryHistory(product.Id, queryRequest)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	hideHistoryFields(c, history.Result)
+	return c.Status(fiber.StatusOK).JSON(history)
+}
+
+// RestoreProduct godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary restores one soft-deleted product by id
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Product id"
+// @Success 200 {object} models.Product
+// @Failure 404 {object} nil
+// @Failure 409 {object} nil "Another product uses the same name"
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/products/{id}/restore [post]
+func RestoreProduct(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
+
+	id := c.Params("id")
+
+	product, err := prodRep.RestoreById(id)
+
+	if err == logic.ErrProductNotFound {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if err == logic.ErrUniqueKeyConflict {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return sendProducts(c, fiber.StatusOK, product, singleProduct)
+}
+
+// BatchRestoreProduct godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param Idempotency-Key header string false "Makes retries of this request safe"
+// @Summary batch restore of soft-deleted products
+// @Accept       json
+// @Produce      json
+// @Param ids body []string true "Product ids"
+// @Success 200 {object} models.BatchRestoreResponse
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/products/batchRestore [post]
+func BatchRestoreProduct(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
+
+	var ids []string
+
+	if err := c.BodyParser(&ids); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse body",
+			"error":   err,
+		})
+	}
+
+	result, err := prodRep.RestoreBatchById(ids)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(result)
+}
+
+// includeDeletedParam reads the includeDeleted query parameter, which only callers allowed to view the trash may set.
+func includeDeletedParam(c *fiber.Ctx) (bool, error) {
+	if c.Query("includeDeleted") != "true" {
+		return false, nil
+	}
+
+	if !auth.HasPermission(c, auth.PermissionProductsDelete) {
+		return false, errors.New("includeDeleted requires the " + auth.PermissionProductsDelete + " permission")
+	}
+
+	return true, nil
+}
+
+// asOfParam reads the optional asOf query parameter of point-in-time reads.
+func asOfParam(c *fiber.Ctx) (*time.Time, error) {
+	return timeParam(c, "asOf")
+}
+
+// timeParam reads an optional RFC 3339 time from the named query parameter.
+func timeParam(c *fiber.Ctx, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time", name)
+	}
+
+	return &t, nil
+}
+
+// includePendingParam reads the includePending query parameter. Pending quantities are current,
+// so they cannot be combined with a point-in-time read.
+func includePendingParam(c *fiber.Ctx, asOf *time.Time) (bool, error) {
+	if c.Query("includePending") != "true" {
+		return false, nil
+	}
+
+	if asOf != nil {
+		return false, errors.New("includePending cannot be combined with asOf")
+	}
+
+	return true, nil
+}
+
+func readOptions(includeDeleted bool, asOf *time.Time) []logic.ReadOption {
+	opts := []logic.ReadOption{logic.IncludeDeleted(includeDeleted)}
+	if asOf != nil {
+		opts = append(opts, logic.AsOf(*asOf))
+	}
+	return opts
+}
+
+// PatchProduct godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param Idempotency-Key header string false "Makes retries of this request safe"
+// @Summary partially updates a product record
+// @Description Accepts a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) limited to name, description and unit.
+// @Accept       application/merge-patch+json
+// @Accept       application/json-patch+json
+// @Produce      json
+// @Param id path string true "Product id"
+// @Param If-Match header string true "ETag of the product version being patched"
+// @Param patch body object true "Merge patch object or JSON Patch operations"
+// @Success 200 {object} models.Product
+// @Header 200 {string} ETag "New product version"
+// @Failure 404 {object} nil
+// @Failure 409 {object} nil "A test operation failed, or another product uses the same name"
+// @Failure 410 {object} nil "Product is deleted"
+// @Failure 412 {object} nil "Product has been modified since the given version"
+// @Failure 415 {object} nil
+// @Failure 422 {object} nil "Patch is invalid or touches immutable fields"
+// @Failure 428 {object} nil "If-Match header is missing"
+// @Failure 403 {object} nil "Missing permission, or fields the caller may not write"
+// @Router /api/products/{id} [patch]
+func PatchProduct(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
+
+	ifMatch := c.Get(fiber.HeaderIfMatch)
+	if ifMatch == "" {
+		return c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+			"message": "If-Match header is required",
+		})
+	}
+
+	version, err := utils.ParseVersionETag(ifMatch)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse If-Match header",
+			"error":   err.Error(),
+		})
+	}
+
+	product, err := prodRep.FindById(c.Params("id"))
+
+	if err == logic.ErrProductDeleted {
+		return c.Status(fiber.StatusGone).Send(nil)
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	if product == nil {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if product.Version != version {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"message": logic.ErrVersionMismatch.Error(),
+		})
+	}
+
+	original, err := patchableDocument(product)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	patched, fields, err := applyPatch(c, original)
+
+	if err == errUnsupportedPatchType {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if errors.Is(err, utils.ErrPatchTestFailed) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "Failed to apply patch",
+			"error":   err.Error(),
+		})
+	}
+
+	var immutable []string
+	for _, field := range fields {
+		if _, ok := models.ProductPatchableFields[field]; !ok {
+			immutable = append(immutable, "/"+field)
+		}
+	}
+	if len(immutable) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "Patch touches fields that cannot be changed",
+			"fields":  immutable,
+		})
+	}
+
+	patchedObject, ok := patched.(map[string]interface{})
+	if !ok {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "Patch must result in an object",
+		})
+	}
+
+	var request models.PatchProductRequest
+	if err := decodePatched(patchedObject, &request); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "Failed to parse patched product",
+			"error":   err.Error(),
+		})
+	}
+
+	valErr := utils.Validate(&request)
+	if valErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to validate patched product",
+			"error":   valErr,
+		})
+	}
+
+	if rejected, err := rejectProtectedFields(c, changedProductFields(product, request.Name, request.Description, &request.Unit)); rejected {
+		return err
+	}
+
+	set, unset := patchChanges(original, patchedObject)
+	if len(set) == 0 && len(unset) == 0 {
+		c.Set(fiber.HeaderETag, utils.VersionETag(product.Version))
+		return sendProducts(c, fiber.StatusOK, product, singleProduct)
+	}
+
+	updatedProduct, err := prodRep.Patch(product.Id, version, set, unset)
+
+	if err == logic.ErrProductNotFound {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if err == logic.ErrProductDeleted {
+		return c.Status(fiber.StatusGone).Send(nil)
+	}
+
+	if err == logic.ErrVersionMismatch {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if err == logic.ErrUniqueKeyConflict {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	c.Set(fiber.HeaderETag, utils.VersionETag(updatedProduct.Version))
+	return sendProducts(c, fiber.StatusOK, updatedProduct, singleProduct)
+}
+
+// BatchProducts godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param Idempotency-Key header string false "Makes retries of this request safe"
+// @Summary runs a batch of product create, update and delete operations
+// @Description In atomic mode (default) all operations run in one transaction and are rolled back on the first failure.
+// @Description In bestEffort mode every operation is applied on its own.
+// @Accept       json
+// @Produce      json
+// @Param batch body models.BatchRequest true "Batch operations"
+// @Success 200 {object} models.BatchResponse "All operations succeeded"
+// @Success 207 {object} models.BatchResponse "Some best-effort operations failed"
+// @Failure 409 {object} models.BatchResponse "Atomic batch rolled back"
+// @Failure 403 {object} nil "Missing permission, or fields the caller may not write"
+// @Router /api/products/batch [post]
+func BatchProducts(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	var request models.BatchRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse body",
+			"error":   err,
+		})
+	}
+
+	valErr := utils.Validate(&request)
+	if valErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to validate body",
+			"error":   valErr,
+		})
+	}
+
+	// The route only requires products:write, so delete operations are checked here.
+	for _, operation := range request.Operations {
+		if operation.Op == models.BatchOpDelete && !auth.HasPermission(c, auth.PermissionProductsDelete) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message":    "Missing permission",
+				"permission": auth.PermissionProductsDelete,
+			})
+		}
+	}
+
+	if rejected, err := rejectProtectedBatchFields(c, dbContext, request); rejected {
+		return err
+	}
+
+	result, err := logic.ExecuteProductBatch(c.UserContext(), dbContext, request)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	if !result.Committed {
+		return sendProducts(c, fiber.StatusConflict, result, batchProducts)
+	}
+
+	for _, item := range result.Results {
+		if item.Status >= fiber.StatusBadRequest {
+			return sendProducts(c, fiber.StatusMultiStatus, result, batchProducts)
+		}
+	}
+
+	return sendProducts(c, fiber.StatusOK, result, batchProducts)
+}
+
+// pendingETag is a weak ETag of a product version together with its pending quantities.
+// It only validates cached reads; If-Match takes the ETag of a read without pending quantities.
+func pendingETag(product *models.Product) string {
+	if product.PendingIncoming == nil || product.PendingOutgoing == nil {
+		return "W/" + utils.VersionETag(product.Version)
+	}
+	return fmt.Sprintf(`W/"%d:%s:%s"`, product.Version, product.PendingIncoming, product.PendingOutgoing)
+}
+
+// queryLastModified is the latest change of any product up to asOf, so it moves when a product is
+// deleted or drops out of the filter, and at least the latest change on the page for products
+// written before their history was kept.
+func queryLastModified(c *fiber.Ctx, dbContext db.DbContext, result models.QueryResponse[models.Product], asOf *time.Time) (time.Time, error) {
+	until := time.Now()
+	if asOf != nil {
+		until = *asOf
+	}
+
+	lastModified, err := logic.NewProductHistoryRepository(c.UserContext(), dbContext).LatestChangeAt(until)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, product := range result.Result {
+		if product.UpdatedAt.After(lastModified) {
+			lastModified = product.UpdatedAt
+		}
+	}
+	return lastModified, nil
+}
+
+// queryETag derives a strong ETag from the query, the fields hidden from the caller and the id, version
+// and pending quantities of every product on the page, so any change to the response body changes it.
+func queryETag(c *fiber.Ctx, result models.QueryResponse[models.Product]) string {
+	hash := sha256.New()
+	hash.Write(c.Body())
+	hash.Write([]byte(c.Context().QueryArgs().String()))
+	fmt.Fprintf(hash, "|%v|%d", productFieldPermissions().HiddenFields(c), result.TotalRecordsCount)
+	for _, product := range result.Result {
+		fmt.Fprintf(hash, "|%s:%d:%d", product.Id.Hex(), product.Version, product.UpdatedAt.UnixNano())
+		if product.PendingIncoming != nil && product.PendingOutgoing != nil {
+			fmt.Fprintf(hash, ":%s:%s", product.PendingIncoming, product.PendingOutgoing)
+		}
+	}
+
+	return `"` + hex.EncodeToString(hash.Sum(nil))[:32] + `"`
 }
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"msrd-products/db"
+	"msrd-products/utils"
+)
+
+func TestUpdateProductSetsOnlyGivenUnit(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	tests := []struct {
+		name    string
+		unit    string
+		setUnit bool
+	}{
+		{"unit omitted", "", false},
+		{"unit cleared", `,"unit":""`, true},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			id := primitive.NewObjectID()
+			stored := bson.D{
+				{Key: "_id", Value: id},
+				{Key: "name", Value: "new name"},
+				{Key: "unit", Value: "kg"},
+				{Key: "version", Value: int64(4)},
+			}
+			mt.AddMockResponses(
+				bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: stored}},
+				mtest.CreateSuccessResponse(),
+			)
+
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				utils.SetLocal[db.DbContext](c, "db_context", mockDbContext{database: mt.DB})
+				return c.Next()
+			})
+			app.Put("/api/products", UpdateProduct)
+
+			body := `{"id":"` + id.Hex() + `","name":"new name"` + test.unit + `}`
+			request := httptest.NewRequest(fiber.MethodPut, "/api/products", strings.NewReader(body))
+			request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			request.Header.Set(fiber.HeaderIfMatch, utils.VersionETag(3))
+
+			response, err := app.Test(request)
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if response.StatusCode != fiber.StatusOK {
+				responseBody, _ := io.ReadAll(response.Body)
+				mt.Fatalf("status %d: %s", response.StatusCode, responseBody)
+			}
+
+			var update bson.Raw
+			for _, event := range mt.GetAllStartedEvents() {
+				if event.CommandName == "findAndModify" {
+					update = event.Command.Lookup("update").Document()
+				}
+			}
+			if update == nil {
+				mt.Fatal("the update was not written")
+			}
+			unit, err := update.LookupErr("$set", "unit")
+			if (err == nil) != test.setUnit {
+				mt.Fatalf("$set unit: got %s", update)
+			}
+			if test.setUnit && unit.StringValue() != "" {
+				mt.Errorf("$set unit: got %s", unit)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"msrd-products/auth"
+	"msrd-products/db"
+	"msrd-products/logic"
+	"msrd-products/models"
+	"os"
+	"sync"
+)
+
+// productFieldPolicy names the permissions guarding individual product fields, by their JSON names.
+// It is empty by default and filled through PRODUCT_FIELD_PERMISSIONS,
+// e.g. "read:quantity=products:stock:read;write:name=products:name:write".
+var productFieldPolicy = auth.FieldPolicy{}
+
+var (
+	productFieldsOnce sync.Once
+	productFields     auth.FieldPolicy
+)
+
+func productFieldPermissions() auth.FieldPolicy {
+	productFieldsOnce.Do(func() {
+		productFields = productFieldPolicy.WithOverrides(os.Getenv("PRODUCT_FIELD_PERMISSIONS"))
+	})
+	return productFields
+}
+
+// productLocator picks the product objects out of a decoded response body.
+type productLocator func(body interface{}) []map[string]interface{}
+
+func singleProduct(body interface{}) []map[string]interface{} {
+	if product, ok := body.(map[string]interface{}); ok {
+		return []map[string]interface{}{product}
+	}
+	return nil
+}
+
+func queriedProducts(body interface{}) []map[string]interface{} {
+	response, _ := body.(map[string]interface{})
+	return objects(response["result"], "")
+}
+
+func batchProducts(body interface{}) []map[string]interface{} {
+	response, _ := body.(map[string]interface{})
+	return objects(response["results"], "product")
+}
+
+// objects returns the objects of a decoded array, or the objects under key of each of its items.
+func objects(array interface{}, key string) (result []map[string]interface{}) {
+	items, _ := array.([]interface{})
+	for _, item := range items {
+		object, ok := item.(map[string]interface{})
+		if ok && key != "" {
+			object, ok = object[key].(map[string]interface{})
+		}
+		if ok {
+			result = append(result, object)
+		}
+	}
+	return
+}
+
+// sendProducts responds with body as JSON, leaving out the product fields the caller may not read.
+func sendProducts(c *fiber.Ctx, status int, body interface{}, locate productLocator) error {
+	hidden := productFieldPermissions().HiddenFields(c)
+	if len(hidden) == 0 {
+		return c.Status(status).JSON(body)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	// Numbers are kept as written so decimal quantities do not pass through float64.
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	for _, product := range locate(decoded) {
+		for _, field := range hidden {
+			delete(product, field)
+		}
+	}
+
+	return c.Status(status).JSON(decoded)
+}
+
+// hideHistoryFields drops the changes of fields the caller may not read from history entries.
+func hideHistoryFields(c *fiber.Ctx, entries []models.ProductHistoryEntry) {
+	hidden := productFieldPermissions().HiddenFields(c)
+	if len(hidden) == 0 {
+		return
+	}
+
+	for i := range entries {
+		changes := []models.FieldChange{}
+		for _, change := range entries[i].Changes {
+			if !contains(hidden, change.Field) {
+				changes = append(changes, change)
+			}
+		}
+		entries[i].Changes = changes
+	}
+}
+
+// changedProductFields lists the editable fields a write changes on the current product,
+// which is nil for a product being created. A nil unit leaves the unit as it is.
+func changedProductFields(current *models.Product, name string, description string, unit *string) (fields []string) {
+	if current == nil {
+		current = &models.Product{}
+	}
+	if name != current.Name {
+		fields = append(fields, "name")
+	}
+	if description != current.Description {
+		fields = append(fields, "description")
+	}
+	if unit != nil && *unit != current.Unit {
+		fields = append(fields, "unit")
+	}
+	return
+}
+
+// rejectProtectedFields answers 403 naming the fields the caller may not write, if there are any.
+func rejectProtectedFields(c *fiber.Ctx, fields []string) (bool, error) {
+	protected := productFieldPermissions().ProtectedFields(c, fields)
+	if len(protected) == 0 {
+		return false, nil
+	}
+
+	return true, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"message": "Missing permission to write fields",
+		"fields":  protected,
+	})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectProtectedBatchFields checks the fields written by the create and update operations of a batch.
+// Updates of products that cannot be loaded are left for the batch to report.
+func rejectProtectedBatchFields(c *fiber.Ctx, dbContext db.DbContext, request models.BatchRequest) (bool, error) {
+	if !productFieldPermissions().Guarded() {
+		return false, nil
+	}
+	prodRep := logic.NewProductsRepository(c.UserContext(), dbContext)
+
+	var fields []string
+	for _, operation := range request.Operations {
+		var current *models.Product
+		if operation.Op == models.BatchOpDelete {
+			continue
+		}
+		if operation.Op == models.BatchOpUpdate {
+			product, err := prodRep.FindById(operation.Id)
+			if err != nil || product == nil {
+				continue
+			}
+			current = product
+		}
+
+		for _, field := range changedProductFields(current, operation.Name, operation.Description, operation.Unit) {
+			if !contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	return rejectProtectedFields(c, fields)
+}
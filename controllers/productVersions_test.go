@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"msrd-products/db"
+	"msrd-products/utils"
+)
+
+func productWriteApp(mt *mtest.T) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		utils.SetLocal[db.DbContext](c, "db_context", mockDbContext{database: mt.DB})
+		return c.Next()
+	})
+	app.Post("/api/products", AddProduct)
+	app.Put("/api/products", UpdateProduct)
+	return app
+}
+
+func TestUpdateProductVersions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	id := primitive.NewObjectID()
+	body := `{"id":"` + id.Hex() + `","name":"new name"}`
+	stored := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "name", Value: "old name"},
+		{Key: "version", Value: int64(5)},
+	}
+
+	tests := []struct {
+		name      string
+		ifMatch   string
+		responses []bson.D
+		status    int
+		emptyBody bool
+	}{
+		{"missing If-Match", "", nil, fiber.StatusPreconditionRequired, false},
+		{"malformed If-Match", `"abc"`, nil, fiber.StatusBadRequest, false},
+		{
+			"stale version",
+			utils.VersionETag(3),
+			[]bson.D{
+				{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+				mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, stored),
+			},
+			fiber.StatusPreconditionFailed,
+			false,
+		},
+		{
+			"unknown product",
+			utils.VersionETag(3),
+			[]bson.D{
+				{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+				mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch),
+			},
+			fiber.StatusNotFound,
+			true,
+		},
+		{
+			"database failure",
+			utils.VersionETag(5),
+			[]bson.D{mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "write failed"})},
+			fiber.StatusInternalServerError,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			mt.AddMockResponses(test.responses...)
+
+			request := httptest.NewRequest(fiber.MethodPut, "/api/products", strings.NewReader(body))
+			request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			if test.ifMatch != "" {
+				request.Header.Set(fiber.HeaderIfMatch, test.ifMatch)
+			}
+
+			response, err := productWriteApp(mt).Test(request)
+			if err != nil {
+				mt.Fatal(err)
+			}
+			responseBody, _ := io.ReadAll(response.Body)
+			if response.StatusCode != test.status {
+				mt.Fatalf("status %d, want %d: %s", response.StatusCode, test.status, responseBody)
+			}
+			if test.emptyBody && len(responseBody) > 0 {
+				mt.Errorf("body: got %s", responseBody)
+			}
+
+			for _, event := range mt.GetAllStartedEvents() {
+				if test.responses == nil {
+					mt.Errorf("%s sent without a usable If-Match", event.CommandName)
+				}
+			}
+		})
+	}
+}
+
+func TestAddProductDatabaseFailure(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("insert fails", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "write failed"}))
+
+		request := httptest.NewRequest(fiber.MethodPost, "/api/products", strings.NewReader(`{"name":"new"}`))
+		request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+		response, err := productWriteApp(mt).Test(request)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		responseBody, _ := io.ReadAll(response.Body)
+		if response.StatusCode != fiber.StatusInternalServerError || len(responseBody) > 0 {
+			mt.Errorf("got %d: %s", response.StatusCode, responseBody)
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"msrd-products/db"
+	"msrd-products/logic"
+	"msrd-products/models"
+	"msrd-products/utils"
+)
+
+// QueryQuarantinedEvents godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary query document status events that could not be applied
+// @Accept       json
+// @Produce      json
+// @Param queryRequest body models.QuarantineQueryRequest true "Query quarantined events"
+// @Success 200 {object} models.QueryResponse[models.QuarantinedEvent]
+// @Failure 400 {object} nil
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/documents/quarantine/query [post]
+func QueryQuarantinedEvents(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	quarantineRep := logic.NewQuarantineRepository(c.UserContext(), dbContext)
+
+	var queryRequest models.QuarantineQueryRequest
+
+	if err := c.BodyParser(&queryRequest); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse body",
+			"error":   err,
+		})
+	}
+
+	valErr := utils.Validate(&queryRequest)
+	if valErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to validate body",
+			"error":   valErr,
+		})
+	}
+
+	err, queryResult := quarantineRep.Query(queryRequest)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(queryResult)
+}
+
+// GetQuarantinedEvent godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary get one quarantined document status event by id
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Quarantined event id"
+// @Success 200 {object} models.QuarantinedEvent
+// @Failure 403 {object} nil "Missing permission"
+// @Failure 404 {object} nil
+// @Router /api/documents/quarantine/{id} [get]
+func GetQuarantinedEvent(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	quarantineRep := logic.NewQuarantineRepository(c.UserContext(), dbContext)
+
+	quarantined, err := quarantineRep.FindById(c.Params("id"))
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	if quarantined == nil {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(quarantined)
+}
+
+// ReplayQuarantinedEvent godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary applies a quarantined document status event again
+// @Description The event stays quarantined while its document is still missing, unless createStub is set.
+// @Description Illegal transitions count as replayed, as they are recorded in the status history.
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Quarantined event id"
+// @Param createStub query bool false "Create a stub document if the document is still missing"
+// @Success 200 {object} models.QuarantineReplayResponse
+// @Failure 403 {object} nil "Missing permission"
+// @Failure 404 {object} nil
+// @Failure 409 {object} nil "Document is still missing or the event has been replayed already"
+// @Router /api/documents/quarantine/{id}/replay [post]
+func ReplayQuarantinedEvent(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	quarantineRep := logic.NewQuarantineRepository(c.UserContext(), dbContext)
+
+	quarantined, err := quarantineRep.FindById(c.Params("id"))
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	if quarantined == nil {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if quarantined.ReplayedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": logic.ErrEventReplayed.Error(),
+		})
+	}
+
+	transitions, err := logic.DocumentStatusTransitionsFromEnv()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	policy, err := logic.MissingDocumentPolicyFromEnv()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	if c.Query("createStub") == "true" {
+		policy = logic.MissingDocumentUpsert
+	}
+
+	document, err := logic.ApplyDocumentStatusEvent(c.UserContext(), dbContext, quarantined.Event, quarantined.Source, transitions, policy)
+
+	if err == logic.ErrDocumentNotFound || err == logic.ErrInvalidDocumentId {
+		quarantined, recordErr := quarantineRep.RecordAttempt(quarantined.Id, err.Error())
+		if recordErr == logic.ErrEventReplayed {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": recordErr.Error(),
+			})
+		}
+		if recordErr != nil {
+			return c.Status(fiber.StatusInternalServerError).Send(nil)
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": err.Error(),
+			"event":   quarantined,
+		})
+	}
+
+	if err != nil && err != logic.ErrIllegalTransition {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	quarantined, err = quarantineRep.MarkReplayed(quarantined.Id)
+
+	if err == logic.ErrEventReplayed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(models.QuarantineReplayResponse{
+		Event:    quarantined,
+		Document: document,
+	})
+}
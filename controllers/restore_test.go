@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"msrd-products/db"
+	"msrd-products/models"
+	"msrd-products/utils"
+)
+
+var duplicateNameResponse = mtest.CreateCommandErrorResponse(mtest.CommandError{
+	Code:    11000,
+	Name:    "DuplicateKey",
+	Message: "E11000 duplicate key error collection: db.products index: tenant_id_name_live",
+})
+
+func restoreApp(mt *mtest.T) *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		utils.SetLocal[db.DbContext](c, "db_context", mockDbContext{database: mt.DB})
+		return c.Next()
+	})
+	app.Post("/api/products/restore", BatchRestoreProduct)
+	app.Post("/api/products/:id/restore", RestoreProduct)
+	return app
+}
+
+func TestRestoreProductNameConflict(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("single", func(mt *mtest.T) {
+		mt.AddMockResponses(duplicateNameResponse)
+
+		request := httptest.NewRequest(fiber.MethodPost, "/api/products/"+primitive.NewObjectID().Hex()+"/restore", nil)
+		response, err := restoreApp(mt).Test(request)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		if response.StatusCode != fiber.StatusConflict {
+			mt.Fatalf("status %d: %s", response.StatusCode, body)
+		}
+	})
+
+	mt.Run("batch", func(mt *mtest.T) {
+		restored := primitive.NewObjectID()
+		conflicting := primitive.NewObjectID()
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{
+				{Key: "_id", Value: restored},
+				{Key: "name", Value: "restored"},
+				{Key: "deleted", Value: true},
+				{Key: "version", Value: int64(2)},
+			}}},
+			mtest.CreateSuccessResponse(),
+			duplicateNameResponse,
+		)
+
+		ids := `["` + restored.Hex() + `","` + conflicting.Hex() + `"]`
+		request := httptest.NewRequest(fiber.MethodPost, "/api/products/restore", strings.NewReader(ids))
+		request.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		response, err := restoreApp(mt).Test(request)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		if response.StatusCode != fiber.StatusOK {
+			mt.Fatalf("status %d: %s", response.StatusCode, body)
+		}
+
+		var result models.BatchRestoreResponse
+		_ = json.Unmarshal(body, &result)
+		if len(result.Restored) != 1 || result.Restored[0] != restored.Hex() ||
+			len(result.Conflicts) != 1 || result.Conflicts[0] != conflicting.Hex() {
+			mt.Errorf("got %s", body)
+		}
+	})
+}
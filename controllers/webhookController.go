@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"msrd-products/db"
+	"msrd-products/logic"
+	"msrd-products/models"
+	"msrd-products/utils"
+)
+
+// ListWebhookSubscriptions godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary list the webhook subscriptions of the tenant
+// @Accept       json
+// @Produce      json
+// @Success 200 {array} models.WebhookSubscription
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/webhooks [get]
+func ListWebhookSubscriptions(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	webhookRep := logic.NewWebhooksRepository(c.UserContext(), dbContext)
+
+	subscriptions, err := webhookRep.ListSubscriptions()
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(subscriptions)
+}
+
+// CreateWebhookSubscription godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary subscribes a URL to document status changes
+// @Description Payloads are posted as JSON with X-Webhook-Timestamp and X-Webhook-Signature headers.
+// @Description The signature is "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret.
+// @Description The secret is only returned in this response.
+// @Description URLs of loopback, link-local and private hosts are refused.
+// @Accept       json
+// @Produce      json
+// @Param subscription body models.CreateWebhookSubscriptionRequest true "New subscription; statuses may contain * for every status"
+// @Success 201 {object} models.CreatedWebhookSubscription
+// @Failure 400 {object} nil
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/webhooks [post]
+func CreateWebhookSubscription(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	webhookRep := logic.NewWebhooksRepository(c.UserContext(), dbContext)
+
+	var request models.CreateWebhookSubscriptionRequest
+
+	if err := c.BodyParser(&request); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse body",
+			"error":   err,
+		})
+	}
+
+	valErr := utils.Validate(&request)
+	if valErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to validate body",
+			"error":   valErr,
+		})
+	}
+
+	created, err := webhookRep.CreateSubscription(request)
+
+	if errors.Is(err, logic.ErrWebhookUrlNotAllowed) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// DeleteWebhookSubscription godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary stops deliveries to a webhook subscription
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Subscription id"
+// @Success 200 {object} models.WebhookSubscription
+// @Failure 403 {object} nil "Missing permission"
+// @Failure 404 {object} nil
+// @Router /api/webhooks/{id} [delete]
+func DeleteWebhookSubscription(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	webhookRep := logic.NewWebhooksRepository(c.UserContext(), dbContext)
+
+	subscription, err := webhookRep.DeleteSubscription(c.Params("id"))
+
+	if err == logic.ErrWebhookNotFound {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(subscription)
+}
+
+// QueryWebhookDeliveries godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary query the webhook delivery log
+// @Accept       json
+// @Produce      json
+// @Param queryRequest body models.WebhookDeliveryQueryRequest true "Query deliveries"
+// @Success 200 {object} models.QueryResponse[models.WebhookDelivery]
+// @Failure 400 {object} nil
+// @Failure 403 {object} nil "Missing permission"
+// @Router /api/webhooks/deliveries/query [post]
+func QueryWebhookDeliveries(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	webhookRep := logic.NewWebhooksRepository(c.UserContext(), dbContext)
+
+	var queryRequest models.WebhookDeliveryQueryRequest
+
+	if err := c.BodyParser(&queryRequest); err != nil {
+		log.Println(err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to parse body",
+			"error":   err,
+		})
+	}
+
+	valErr := utils.Validate(&queryRequest)
+	if valErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to validate body",
+			"error":   valErr,
+		})
+	}
+
+	err, queryResult := webhookRep.QueryDeliveries(queryRequest)
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(queryResult)
+}
+
+// GetWebhookDelivery godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary get one webhook delivery with its attempts
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Delivery id"
+// @Success 200 {object} models.WebhookDelivery
+// @Failure 403 {object} nil "Missing permission"
+// @Failure 404 {object} nil
+// @Router /api/webhooks/deliveries/{id} [get]
+func GetWebhookDelivery(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	webhookRep := logic.NewWebhooksRepository(c.UserContext(), dbContext)
+
+	delivery, err := webhookRep.FindDelivery(c.Params("id"))
+
+	if err == logic.ErrWebhookNotFound {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(delivery)
+}
+
+// RedeliverWebhook godoc
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Summary queues a webhook delivery to be sent again
+// @Description The dispatcher sends it on its next run, with a fresh retry budget.
+// @Accept       json
+// @Produce      json
+// @Param id path string true "Delivery id"
+// @Success 202 {object} models.WebhookDelivery
+// @Failure 403 {object} nil "Missing permission"
+// @Failure 404 {object} nil
+// @Router /api/webhooks/deliveries/{id}/redeliver [post]
+func RedeliverWebhook(c *fiber.Ctx) error {
+	dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+	if dbContext == nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+	webhookRep := logic.NewWebhooksRepository(c.UserContext(), dbContext)
+
+	delivery, err := webhookRep.Redeliver(c.Params("id"))
+
+	if err == logic.ErrWebhookNotFound {
+		return c.Status(fiber.StatusNotFound).Send(nil)
+	}
+
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).Send(nil)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(delivery)
+}
@@ -2,17 +2,35 @@ package db
 
 import (
 	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"log"
+	"reflect"
 	"time"
 )
 
+const indexOptionsConflict = 85
+
+var historyRegistry = bson.NewRegistryBuilder().
+	RegisterTypeMapEntry(bsontype.EmbeddedDocument, reflect.TypeOf(bson.M{})).
+	Build()
+
 type DbContext interface {
 	Dispose()
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
 	GetProductsCollection() *mongo.Collection
 	GetDocumentsCollection() *mongo.Collection
+	GetDocumentLinesCollection() *mongo.Collection
+	GetQuarantinedEventsCollection() *mongo.Collection
+	GetWebhookSubscriptionsCollection() *mongo.Collection
+	GetWebhookDeliveriesCollection() *mongo.Collection
+	GetIdempotencyKeysCollection() *mongo.Collection
+	GetProductHistoryCollection() *mongo.Collection
+	GetApiKeysCollection() *mongo.Collection
 }
 
 type connection struct {
@@ -22,7 +40,8 @@ type connection struct {
 }
 
 type DbContextConfig struct {
-	ContextTimeout time.Duration
+	ContextTimeout    time.Duration
+	IdempotencyKeyTTL time.Duration
 }
 
 func BuildDbContext(connectionString string, database string, configSetup func(config *DbContextConfig)) (DbContext, error) {
@@ -32,6 +51,7 @@ func BuildDbContext(connectionString string, database string, configSetup func(c
 
 	//init default values
 	connection.connectionConfig.ContextTimeout = 30 * time.Second
+	connection.connectionConfig.IdempotencyKeyTTL = 24 * time.Hour
 
 	//option to override default values
 	configSetup(&connection.connectionConfig)
@@ -53,9 +73,151 @@ func BuildDbContext(connectionString string, database string, configSetup func(c
 
 	connection.database = connection.client.Database(database)
 
+	err = connection.ensureIndexes(ctx)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
 	return connection, nil
 }
 
+func (connection connection) ensureIndexes(ctx context.Context) error {
+	_, err := connection.GetProductsCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "deleted", Value: 1}, {Key: "deleted_at", Value: 1}},
+		Options: options.Index().SetName("deleted_deleted_at"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetProductsCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "deleted", Value: 1}, {Key: "deleted_at", Value: 1}},
+		Options: options.Index().SetName("tenant_id_deleted_deleted_at"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The name is the unique key among the live products of a tenant.
+	_, err = connection.GetProductsCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetName("tenant_id_name_live").SetUnique(true).SetPartialFilterExpression(bson.M{"deleted": nil}),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetDocumentsCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "_id", Value: 1}},
+		Options: options.Index().SetName("tenant_id_id"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetDocumentsCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "status", Value: 1}, {Key: "updated_at", Value: -1}},
+		Options: options.Index().SetName("tenant_id_status_updated_at"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetDocumentLinesCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "product_id", Value: 1}},
+		Options: options.Index().SetName("tenant_id_product_id"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetDocumentLinesCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "document_id", Value: 1}},
+		Options: options.Index().SetName("tenant_id_document_id"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetQuarantinedEventsCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "replayed_at", Value: 1}, {Key: "quarantined_at", Value: -1}},
+		Options: options.Index().SetName("tenant_id_replayed_at_quarantined_at"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetWebhookSubscriptionsCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "statuses", Value: 1}},
+		Options: options.Index().SetName("tenant_id_statuses"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetWebhookDeliveriesCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "subscription_id", Value: 1}, {Key: "payload.id", Value: 1}},
+		Options: options.Index().SetName("subscription_id_payload_id").SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetWebhookDeliveriesCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+		Options: options.Index().SetName("status_next_attempt_at"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetProductHistoryCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "product_id", Value: 1}, {Key: "timestamp", Value: -1}},
+		Options: options.Index().SetName("product_id_timestamp"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetProductHistoryCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "timestamp", Value: -1}},
+		Options: options.Index().SetName("timestamp"),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = connection.GetApiKeysCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetName("hash").SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	return connection.ensureTTLIndex(ctx, connection.GetIdempotencyKeysCollection(), "created_at", connection.connectionConfig.IdempotencyKeyTTL)
+}
+
+// ensureTTLIndex creates a TTL index on field, or adjusts the expiry of an existing one.
+func (connection connection) ensureTTLIndex(ctx context.Context, collection *mongo.Collection, field string, ttl time.Duration) error {
+	name := field + "_ttl"
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetName(name).SetExpireAfterSeconds(int32(ttl.Seconds())),
+	})
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.Code == indexOptionsConflict {
+		return connection.database.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: collection.Name()},
+			{Key: "index", Value: bson.M{"name": name, "expireAfterSeconds": int32(ttl.Seconds())}},
+		}).Err()
+	}
+
+	return err
+}
+
 func (connection connection) GetProductsCollection() *mongo.Collection {
 	collection := connection.database.Collection("products")
 	return collection
@@ -66,6 +228,60 @@ func (connection connection) GetDocumentsCollection() *mongo.Collection {
 	return collection
 }
 
+func (connection connection) GetDocumentLinesCollection() *mongo.Collection {
+	collection := connection.database.Collection("document_lines")
+	return collection
+}
+
+func (connection connection) GetQuarantinedEventsCollection() *mongo.Collection {
+	collection := connection.database.Collection("quarantined_events")
+	return collection
+}
+
+func (connection connection) GetWebhookSubscriptionsCollection() *mongo.Collection {
+	collection := connection.database.Collection("webhook_subscriptions")
+	return collection
+}
+
+func (connection connection) GetWebhookDeliveriesCollection() *mongo.Collection {
+	collection := connection.database.Collection("webhook_deliveries")
+	return collection
+}
+
+func (connection connection) GetIdempotencyKeysCollection() *mongo.Collection {
+	collection := connection.database.Collection("idempotency_keys")
+	return collection
+}
+
+// GetProductHistoryCollection decodes embedded documents of untyped fields as bson.M,
+// so before and after values of history entries render as plain JSON objects.
+func (connection connection) GetProductHistoryCollection() *mongo.Collection {
+	collection := connection.database.Collection("product_history", options.Collection().SetRegistry(historyRegistry))
+	return collection
+}
+
+func (connection connection) GetApiKeysCollection() *mongo.Collection {
+	collection := connection.database.Collection("api_keys")
+	return collection
+}
+
+// WithTransaction runs fn in a multi-document transaction. Repositories built from the context
+// passed to fn take part in it. Transactions need MongoDB running as a replica set.
+func (connection connection) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := connection.client.StartSession()
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+
+	return err
+}
+
 func (connection connection) Dispose() {
 	ctx, cancel := context.WithTimeout(context.Background(), connection.connectionConfig.ContextTimeout)
 	defer cancel()
@@ -0,0 +1,60 @@
+package jobs
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"msrd-products/db"
+	"msrd-products/logic"
+	"msrd-products/utils"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// LaunchProductPurgeJob purges expired product tombstones every PURGE_INTERVAL,
+// or once when no interval is configured.
+func LaunchProductPurgeJob(dbContext db.DbContext) {
+	config := logic.PurgeConfig{
+		Retention:  utils.DurationEnv("PURGE_RETENTION", 30*24*time.Hour),
+		BatchSize:  int64(utils.IntEnv("PURGE_BATCH_SIZE", 500)),
+		MaxBatches: utils.IntEnv("PURGE_MAX_BATCHES", 0),
+		DryRun:     utils.BoolEnv("PURGE_DRY_RUN", false),
+	}
+	interval := utils.DurationEnv("PURGE_INTERVAL", 0)
+
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		runProductPurge(dbContext, config)
+
+		if interval <= 0 {
+			return
+		}
+
+		select {
+		case sig := <-sigchan:
+			logrus.Infof("Caught signal %v: terminating", sig)
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func runProductPurge(dbContext db.DbContext, config logic.PurgeConfig) {
+	report, err := logic.PurgeDeletedProducts(context.Background(), dbContext, config)
+	if err != nil {
+		logrus.Errorf("Product purge failed: %s", err)
+		return
+	}
+
+	if report.DryRun {
+		logrus.Infof("Product purge dry run: %d products deleted before %s would be purged, first batch: %v",
+			report.Candidates, report.Cutoff.Format(time.RFC3339), report.SampleIds)
+		return
+	}
+
+	logrus.Infof("Product purge: purged %d of %d products deleted before %s, dependents: %v",
+		report.Purged, report.Candidates, report.Cutoff.Format(time.RFC3339), report.Dependents)
+}
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"github.com/sirupsen/logrus"
+	"msrd-products/db"
+	"msrd-products/logic"
+	"msrd-products/utils"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// LaunchWebhookDispatcher sends due webhook deliveries every WEBHOOK_POLL_INTERVAL until terminated.
+// A full batch is followed by the next one right away.
+func LaunchWebhookDispatcher(dbContext db.DbContext) {
+	config := logic.WebhookDispatchConfig{
+		BatchSize:         utils.IntEnv("WEBHOOK_BATCH_SIZE", 50),
+		Timeout:           utils.DurationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+		MaxAttempts:       utils.IntEnv("WEBHOOK_MAX_ATTEMPTS", 10),
+		BackoffBase:       utils.DurationEnv("WEBHOOK_BACKOFF_BASE", 30*time.Second),
+		BackoffMax:        utils.DurationEnv("WEBHOOK_BACKOFF_MAX", 6*time.Hour),
+		Lease:             utils.DurationEnv("WEBHOOK_LEASE", time.Minute),
+		AllowPrivateHosts: utils.BoolEnv("WEBHOOK_ALLOW_PRIVATE_HOSTS", false),
+	}
+	interval := utils.DurationEnv("WEBHOOK_POLL_INTERVAL", 5*time.Second)
+
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
+
+	for {
+		report, err := logic.DispatchWebhooks(context.Background(), dbContext, config)
+		if err != nil {
+			logrus.Errorf("Webhook dispatch failed: %s", err)
+		} else if report.Delivered+report.Retried+report.Failed+report.LeaseLost > 0 {
+			logrus.Infof("Webhook dispatch: %d delivered, %d to retry, %d failed, %d lost their lease", report.Delivered, report.Retried, report.Failed, report.LeaseLost)
+		}
+
+		wait := interval
+		if err == nil && report.Delivered+report.Retried+report.Failed+report.LeaseLost >= config.BatchSize {
+			wait = 0
+		}
+
+		select {
+		case sig := <-sigchan:
+			logrus.Infof("Caught signal %v: terminating", sig)
+			return
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package consumers
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	_ "gopkg.in/confluentinc/confluent-kafka-go.v1/kafka/librdkafka_vendor"
+	"msrd-products/db"
+	intrnalKafka "msrd-products/kafka"
+	kafkaModels "msrd-products/kafka/documentLineModels"
+	"msrd-products/logic"
+	"msrd-products/models"
+	"time"
+)
+
+const documentLinesTopic = "MsrdStocks.public.document_lines"
+
+func LaunchDocumentLinesConsumer(dbContext db.DbContext) {
+
+	err := intrnalKafka.Subscribe[kafkaModels.PostgreSqlEvent](documentLinesTopic, func(message kafkaModels.PostgreSqlEvent, metadata intrnalKafka.Metadata) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		switch message.Operation {
+		case "r", "c", "u":
+			ctx = withEventTenant(ctx, message.After.TenantId, metadata.Headers)
+			lineRep := logic.NewDocumentLinesRepository(ctx, dbContext)
+
+			line, err := documentLine(message.After)
+			if err != nil {
+				logrus.Errorf("Received invalid document line %s from %s: %s", message.After.Id, documentLinesTopic, err)
+				return intrnalKafka.Fatal(err)
+			}
+
+			_, err = lineRep.UpsertByEvent(line)
+			if err != nil {
+				return err
+			}
+
+			logrus.Infof("Stored document line %s of document %s", line.Id, message.After.DocumentId)
+		case "d":
+			if message.Before == nil {
+				logrus.Warnf("Received delete without before image from %s", documentLinesTopic)
+				return nil
+			}
+
+			ctx = withEventTenant(ctx, message.Before.TenantId, metadata.Headers)
+			lineRep := logic.NewDocumentLinesRepository(ctx, dbContext)
+
+			err := lineRep.DeleteByEvent(message.Before.Id)
+			if err != nil {
+				return err
+			}
+
+			logrus.Infof("Deleted document line %s of document %s", message.Before.Id, message.Before.DocumentId)
+		}
+		return nil
+	})
+
+	if err != nil {
+		logrus.Errorf("Error in DocumentLinesConsumer: %s", err)
+		return
+	}
+}
+
+func documentLine(value *kafkaModels.Value) (line models.DocumentLine, err error) {
+	line.Id = value.Id
+
+	line.DocumentId, err = primitive.ObjectIDFromHex(value.DocumentId)
+	if err != nil {
+		return
+	}
+
+	line.ProductId, err = primitive.ObjectIDFromHex(value.ProductId)
+	if err != nil {
+		return
+	}
+
+	quantity, err := models.ParseDecimal(value.Quantity)
+	if err != nil {
+		return
+	}
+	line.Quantity = &quantity
+
+	if value.Direction != models.DocumentLineIn && value.Direction != models.DocumentLineOut {
+		return line, fmt.Errorf("unknown direction %q", value.Direction)
+	}
+	line.Direction = value.Direction
+
+	return
+}
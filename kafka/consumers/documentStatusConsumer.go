@@ -12,41 +12,76 @@ import (
 	"time"
 )
 
+const documentStatusesTopic = "MsrdStocks.public.document_statuses"
+
 func LaunchDocumentStatusConsumer(dbContext db.DbContext) {
 
-	err := intrnalKafka.Subscribe[kafkaModels.PostgreSqlEvent]("MsrdStocks.public.document_statuses", func(message kafkaModels.PostgreSqlEvent) bool {
+	transitions, err := logic.DocumentStatusTransitionsFromEnv()
+	if err != nil {
+		logrus.Errorf("Error in DocumentStatusConsumer: %s", err)
+		return
+	}
+
+	missingDocumentPolicy, err := logic.MissingDocumentPolicyFromEnv()
+	if err != nil {
+		logrus.Errorf("Error in DocumentStatusConsumer: %s", err)
+		return
+	}
+
+	err = intrnalKafka.SubscribeOrdered[kafkaModels.PostgreSqlEvent](documentStatusesTopic, documentStatusKey, func(message kafkaModels.PostgreSqlEvent, metadata intrnalKafka.Metadata) error {
 		if message.Operation == "r" || message.Operation == "c" || message.Operation == "u" {
 			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
-			docRep := logic.NewDocumentsRepository(ctx, dbContext)
-			document, err := docRep.FindById(message.After.DocumentId)
+			ctx = withEventTenant(ctx, message.After.TenantId, metadata.Headers)
 
-			if err != nil {
-				return false
+			event := models.DocumentStatusEvent{
+				DocumentId: message.After.DocumentId,
+				Status:     message.After.Status,
+				TenantId:   message.After.TenantId,
+				Created:    message.Operation == "r" || message.Operation == "c",
 			}
+			source := &models.EventSource{
+				Topic:     metadata.Topic,
+				Partition: metadata.Partition,
+				Offset:    metadata.Offset,
+			}
+
+			document, err := logic.ApplyDocumentStatusEvent(ctx, dbContext, event, source, transitions, missingDocumentPolicy)
 
-			if document == nil {
-				logrus.Warnln("Received non existing document id from MsrdStocks.public.document_statuses: %s", message.After.DocumentId)
-				return false
+			if err == logic.ErrDocumentNotFound || err == logic.ErrInvalidDocumentId {
+				_, err = logic.NewQuarantineRepository(ctx, dbContext).Add(event, source, err.Error())
+				if err != nil {
+					return err
+				}
+				logrus.Warnf("Quarantined event for document %s from %s[%d]@%d", event.DocumentId, metadata.Topic, metadata.Partition, metadata.Offset)
+				return nil
 			}
 
-			document, err = docRep.UpdateByEvent(models.UpdateDocumentEvent{
-				Id:     document.Id,
-				Status: message.After.Status,
-			})
+			if err == logic.ErrIllegalTransition {
+				logrus.Warnf("Flagged illegal status transition of %s to %s from %s[%d]@%d", event.DocumentId, event.Status, metadata.Topic, metadata.Partition, metadata.Offset)
+				return nil
+			}
 
 			if err != nil {
-				return false
+				return err
 			}
 
-			logrus.Infoln("Updated the status of %s to %f", message.After.DocumentId, message.After.Status)
+			logrus.Infof("Updated the status of %s to %s", event.DocumentId, event.Status)
 			logrus.Infoln(document)
 		}
-		return true
+		return nil
 	})
 
 	if err != nil {
-		logrus.Errorln("Error in ProductStockRecordsConsumer: %s", err)
+		logrus.Errorf("Error in DocumentStatusConsumer: %s", err)
 		return
 	}
 }
+
+// documentStatusKey orders status events by document, so transitions are checked in the order they happened.
+func documentStatusKey(message kafkaModels.PostgreSqlEvent) string {
+	if message.After == nil {
+		return ""
+	}
+	return message.After.DocumentId
+}
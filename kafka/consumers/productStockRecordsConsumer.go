@@ -2,8 +2,10 @@ package consumers
 
 import (
 	"context"
+	"fmt"
 	"github.com/sirupsen/logrus"
 	_ "gopkg.in/confluentinc/confluent-kafka-go.v1/kafka/librdkafka_vendor"
+	"msrd-products/auth"
 	"msrd-products/db"
 	intrnalKafka "msrd-products/kafka"
 	kafkaModels "msrd-products/kafka/models"
@@ -12,48 +14,106 @@ import (
 	"time"
 )
 
+const stockRecordsTopic = "MsrdStocks.public.stock_records"
+
 func LaunchProductStockRecordsConsumer(dbContext db.DbContext) {
 
-	err := intrnalKafka.Subscribe[kafkaModels.PostgreSqlEvent]("MsrdStocks.public.stock_records", func(message kafkaModels.PostgreSqlEvent) bool {
+	deletedProductPolicy, err := logic.DeletedProductPolicyFromEnv()
+	if err != nil {
+		logrus.Errorf("Error in ProductStockRecordsConsumer: %s", err)
+		return
+	}
+
+	err = intrnalKafka.SubscribeOrdered[kafkaModels.PostgreSqlEvent](stockRecordsTopic, stockRecordKey, func(message kafkaModels.PostgreSqlEvent, metadata intrnalKafka.Metadata) error {
 		if message.Operation == "r" || message.Operation == "c" {
 			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
+			ctx = auth.WithActor(ctx, auth.SystemActor("kafka:"+stockRecordsTopic))
+			ctx = withEventTenant(ctx, message.After.TenantId, metadata.Headers)
 			prodRep := logic.NewProductsRepository(ctx, dbContext)
 			product, err := prodRep.FindById(message.After.ProductId)
 
+			if err == logic.ErrProductDeleted {
+				product, err = applyDeletedProductPolicy(deletedProductPolicy, prodRep, message)
+				if product == nil {
+					return err
+				}
+			}
+
 			if err != nil {
-				return false
+				return err
 			}
 
 			if product == nil {
-				logrus.Warnln("Received non existing product id from MsrdStocks.public.stock_records: %s", message.After.ProductId)
-				return false
+				logrus.Warnf("Received non existing product id from MsrdStocks.public.stock_records: %s", message.After.ProductId)
+				return intrnalKafka.Fatal(fmt.Errorf("product %s not found", message.After.ProductId))
 			}
 
-			if &message.After.ActualQuantity == product.Quantity {
-				logrus.Warnln("Nothing to update MsrdStocks.public.stock_records: %s", message.After.ProductId)
-				return false
+			quantity, err := models.ParseDecimal(message.After.ActualQuantity)
+
+			if err != nil {
+				logrus.Errorf("Received invalid quantity from MsrdStocks.public.stock_records for %s: %s", message.After.ProductId, err)
+				return intrnalKafka.Fatal(err)
+			}
+
+			quantity = logic.RoundQuantity(quantity, product.Unit)
+
+			if product.Quantity != nil && product.Quantity.Equal(quantity) {
+				logrus.Warnf("Nothing to update MsrdStocks.public.stock_records: %s", message.After.ProductId)
+				return nil
 			}
 
-			product.Quantity = new(float32)
-			*product.Quantity = *&(message.After.ActualQuantity)
 			product, err = prodRep.UpdateByEvent(models.UpdateProductEvent{
 				Id:       product.Id,
-				Quantity: product.Quantity,
+				Quantity: &quantity,
 			})
 
 			if err != nil {
-				return false
+				return err
 			}
 
-			logrus.Infoln("Updated the stock quantity of %s to %f", message.After.ProductId, message.After.ActualQuantity)
+			logrus.Infof("Updated the stock quantity of %s to %s", message.After.ProductId, quantity)
 			logrus.Infoln(product)
 		}
-		return true
+		return nil
 	})
 
 	if err != nil {
-		logrus.Errorln("Error in ProductStockRecordsConsumer: %s", err)
+		logrus.Errorf("Error in ProductStockRecordsConsumer: %s", err)
 		return
 	}
 }
+
+// applyDeletedProductPolicy handles an event for a soft-deleted product. It returns the revived product
+// to continue with, or nil with the error to finish the event with.
+func applyDeletedProductPolicy(policy logic.DeletedProductPolicy, prodRep logic.ProductsRepository, message kafkaModels.PostgreSqlEvent) (*models.Product, error) {
+	productId := message.After.ProductId
+
+	switch policy {
+	case logic.DeletedProductRevive:
+		product, err := prodRep.RestoreById(productId)
+		if err == logic.ErrUniqueKeyConflict {
+			logrus.Warnf("Cannot revive deleted product %s from %s: %s", productId, stockRecordsTopic, err)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		logrus.Infof("Revived deleted product %s from %s", productId, stockRecordsTopic)
+		return product, nil
+	case logic.DeletedProductDeadLetter:
+		logrus.Warnf("Dead-lettering event for deleted product %s from %s", productId, stockRecordsTopic)
+		return nil, intrnalKafka.Fatal(logic.ErrProductDeleted)
+	default:
+		logrus.Infof("Skipped event for deleted product %s from %s", productId, stockRecordsTopic)
+		return nil, nil
+	}
+}
+
+// stockRecordKey orders stock records by product, so the last record of a product sets its quantity.
+func stockRecordKey(message kafkaModels.PostgreSqlEvent) string {
+	if message.After == nil {
+		return ""
+	}
+	return message.After.ProductId
+}
@@ -0,0 +1,27 @@
+package consumers
+
+import (
+	"context"
+	"msrd-products/auth"
+	intrnalKafka "msrd-products/kafka"
+	"os"
+)
+
+// withEventTenant scopes an event to the tenant named in its payload or, failing that, in the header
+// named by KAFKA_TENANT_HEADER (tenant_id by default). Events naming no tenant stay unscoped,
+// which is safe because they address records by globally unique ids.
+func withEventTenant(ctx context.Context, payloadTenant string, headers intrnalKafka.Headers) context.Context {
+	tenant := payloadTenant
+	if tenant == "" {
+		header := os.Getenv("KAFKA_TENANT_HEADER")
+		if header == "" {
+			header = "tenant_id"
+		}
+		tenant = headers[header]
+	}
+
+	if tenant == "" {
+		return ctx
+	}
+	return auth.WithTenant(ctx, tenant)
+}
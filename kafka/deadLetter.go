@@ -0,0 +1,91 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderDeadLetterError       = "dead-letter-error"
+	HeaderDeadLetterErrorClass  = "dead-letter-error-class"
+	HeaderDeadLetterAttempts    = "dead-letter-attempts"
+	HeaderDeadLetterTopic       = "dead-letter-original-topic"
+	HeaderDeadLetterPartition   = "dead-letter-original-partition"
+	HeaderDeadLetterOffset      = "dead-letter-original-offset"
+	HeaderDeadLetterTimestamp   = "dead-letter-timestamp"
+	HeaderDeadLetterRedriveFrom = "dead-letter-redriven-from"
+)
+
+// ErrDeadLetterFailed stops a consumer when a message could neither be handled nor dead-lettered,
+// since committing past it would lose it.
+var ErrDeadLetterFailed = errors.New("failed to dead-letter message")
+
+var (
+	producerOnce sync.Once
+	producer     *kafka.Producer
+	producerErr  error
+)
+
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+func sharedProducer() (*kafka.Producer, error) {
+	producerOnce.Do(func() {
+		producer, producerErr = kafka.NewProducer(&kafka.ConfigMap{
+			"bootstrap.servers": os.Getenv("KAFKA_BOOTSTRAP_SERVERS"),
+		})
+	})
+	return producer, producerErr
+}
+
+// produce sends a message and waits for the broker to acknowledge it.
+func produce(message *kafka.Message) error {
+	p, err := sharedProducer()
+	if err != nil {
+		return err
+	}
+
+	deliveryChan := make(chan kafka.Event, 1)
+	err = p.Produce(message, deliveryChan)
+	if err != nil {
+		return err
+	}
+
+	delivery := (<-deliveryChan).(*kafka.Message)
+	return delivery.TopicPartition.Error
+}
+
+// publishDeadLetter copies a message that could not be handled to the dead-letter topic of its topic,
+// keeping its key, payload and headers, and adds headers describing the failure.
+func publishDeadLetter(message *kafka.Message, cause error, attempts int) error {
+	topic := *message.TopicPartition.Topic
+	deadLetterTopic := DeadLetterTopic(topic)
+
+	headers := append([]kafka.Header{}, message.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDeadLetterError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDeadLetterErrorClass, Value: []byte(errorClass(cause))},
+		kafka.Header{Key: HeaderDeadLetterAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDeadLetterTopic, Value: []byte(topic)},
+		kafka.Header{Key: HeaderDeadLetterPartition, Value: []byte(strconv.Itoa(int(message.TopicPartition.Partition)))},
+		kafka.Header{Key: HeaderDeadLetterOffset, Value: []byte(message.TopicPartition.Offset.String())},
+		kafka.Header{Key: HeaderDeadLetterTimestamp, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+
+	err := produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &deadLetterTopic, Partition: kafka.PartitionAny},
+		Key:            message.Key,
+		Value:          message.Value,
+		Headers:        headers,
+	})
+	if err != nil {
+		return fmt.Errorf("dead-lettering %s to %s: %w", message.TopicPartition, deadLetterTopic, err)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package documentLineModels
+
+// PostgreSqlEvent carries the row before the change too, as deletes have no after image.
+type PostgreSqlEvent struct {
+	Before    *Value `json:"before"`
+	After     *Value `json:"after"`
+	Operation string `json:"op"`
+}
+
+// Value expects the quantity as a string (Debezium decimal.handling.mode=string).
+type Value struct {
+	Id         string `json:"id"`
+	DocumentId string `json:"document_id"`
+	ProductId  string `json:"product_id"`
+	Quantity   string `json:"quantity"`
+	Direction  string `json:"direction"`
+	TenantId   string `json:"tenant_id"`
+}
@@ -8,4 +8,5 @@ type PostgreSqlEvent struct {
 type Value struct {
 	DocumentId string `json:"document_id"`
 	Status     string `json:"status"`
+	TenantId   string `json:"tenant_id"`
 }
@@ -5,7 +5,10 @@ type PostgreSqlEvent struct {
 	Operation string `json:"op"`
 }
 
+// Value expects numeric columns as strings (Debezium decimal.handling.mode=string),
+// so quantities arrive without binary float rounding.
 type Value struct {
-	ProductId      string  `json:"product_id"`
-	ActualQuantity float32 `json:"quantity_actual"`
+	ProductId      string `json:"product_id"`
+	ActualQuantity string `json:"quantity_actual"`
+	TenantId       string `json:"tenant_id"`
 }
@@ -0,0 +1,177 @@
+package kafka
+
+import (
+	"github.com/sirupsen/logrus"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"msrd-products/utils"
+	"sort"
+	"time"
+)
+
+// CommitPolicy decides how often handled offsets are committed. Offsets are committed once
+// BatchSize messages were handled or Interval has passed since the last commit, whichever comes first.
+type CommitPolicy struct {
+	BatchSize int
+	Interval  time.Duration
+}
+
+// CommitPolicyFromEnv reads KAFKA_COMMIT_BATCH_SIZE and KAFKA_COMMIT_INTERVAL.
+func CommitPolicyFromEnv() CommitPolicy {
+	return CommitPolicy{
+		BatchSize: utils.IntEnv("KAFKA_COMMIT_BATCH_SIZE", 100),
+		Interval:  utils.DurationEnv("KAFKA_COMMIT_INTERVAL", 5*time.Second),
+	}
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+type trackedOffset struct {
+	offset kafka.Offset
+	done   bool
+}
+
+// offsetTracker collects the offsets to commit per partition. Messages may complete out of order,
+// so a partition's offset only advances past messages that completed together with all earlier ones.
+// A commit that fails keeps its offsets for the next one, so every message is handled at least once.
+type offsetTracker struct {
+	policy      CommitPolicy
+	assignments map[partitionKey]*assignment
+	received    map[partitionKey][]trackedOffset
+	pending     map[partitionKey]kafka.Offset
+	marked      int
+	lastCommit  time.Time
+}
+
+func newOffsetTracker(policy CommitPolicy) *offsetTracker {
+	return &offsetTracker{
+		policy:      policy,
+		assignments: map[partitionKey]*assignment{},
+		received:    map[partitionKey][]trackedOffset{},
+		pending:     map[partitionKey]kafka.Offset{},
+		lastCommit:  time.Now(),
+	}
+}
+
+// Track records a message handed out for handling and returns the current assignment of its partition.
+// Messages of a partition arrive in offset order.
+func (t *offsetTracker) Track(tp kafka.TopicPartition) *assignment {
+	key := partitionKey{*tp.Topic, tp.Partition}
+	if t.assignments[key] == nil {
+		t.assignments[key] = newAssignment()
+	}
+	t.received[key] = append(t.received[key], trackedOffset{offset: tp.Offset})
+	return t.assignments[key]
+}
+
+// Done records a handled message and advances its partition past the completed prefix.
+// The committed offset is the one after the last message of that prefix, the next to consume.
+// Completions from an earlier assignment of the partition are ignored.
+func (t *offsetTracker) Done(done completion) {
+	tp := done.tp
+	key := partitionKey{*tp.Topic, tp.Partition}
+	if t.assignments[key] != done.assignment {
+		return
+	}
+	offsets := t.received[key]
+
+	i := sort.Search(len(offsets), func(i int) bool { return offsets[i].offset >= tp.Offset })
+	if i == len(offsets) || offsets[i].offset != tp.Offset {
+		return
+	}
+	offsets[i].done = true
+
+	completed := 0
+	for completed < len(offsets) && offsets[completed].done {
+		completed++
+	}
+	if completed > 0 {
+		t.pending[key] = offsets[completed-1].offset + 1
+		t.marked += completed
+		t.received[key] = offsets[completed:]
+	}
+}
+
+// InFlight counts the messages of the given partitions, or of all partitions for nil, that are not done yet.
+func (t *offsetTracker) InFlight(partitions []kafka.TopicPartition) (count int) {
+	for key, offsets := range t.received {
+		if partitions != nil && !containsPartition(partitions, key) {
+			continue
+		}
+		for _, offset := range offsets {
+			if !offset.done {
+				count++
+			}
+		}
+	}
+	return
+}
+
+func (t *offsetTracker) Due() bool {
+	return len(t.pending) > 0 && (t.marked >= t.policy.BatchSize || time.Since(t.lastCommit) >= t.policy.Interval)
+}
+
+// Commit synchronously commits the pending offsets of the given partitions, or of all partitions for nil.
+func (t *offsetTracker) Commit(c *kafka.Consumer, partitions []kafka.TopicPartition) error {
+	var offsets []kafka.TopicPartition
+	for key, offset := range t.pending {
+		if partitions == nil || containsPartition(partitions, key) {
+			topic := key.topic
+			offsets = append(offsets, kafka.TopicPartition{Topic: &topic, Partition: key.partition, Offset: offset})
+		}
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	committed, err := c.CommitOffsets(offsets)
+	if err != nil {
+		logrus.Errorf("%% Failed to commit %v: %s\n", offsets, err)
+		return err
+	}
+
+	for _, tp := range committed {
+		key := partitionKey{*tp.Topic, tp.Partition}
+		if tp.Error == nil && t.pending[key] == tp.Offset {
+			delete(t.pending, key)
+		}
+	}
+	if partitions == nil {
+		t.marked = 0
+		t.lastCommit = time.Now()
+	}
+
+	logrus.Infof("%% Committed %v\n", committed)
+	return nil
+}
+
+// Forget drops the offsets of partitions that are no longer assigned and revokes their assignments.
+func (t *offsetTracker) Forget(partitions []kafka.TopicPartition) {
+	for key, assigned := range t.assignments {
+		if containsPartition(partitions, key) {
+			assigned.Revoke()
+			delete(t.assignments, key)
+		}
+	}
+	for key := range t.received {
+		if containsPartition(partitions, key) {
+			delete(t.received, key)
+		}
+	}
+	for key := range t.pending {
+		if containsPartition(partitions, key) {
+			delete(t.pending, key)
+		}
+	}
+}
+
+func containsPartition(partitions []kafka.TopicPartition, key partitionKey) bool {
+	for _, tp := range partitions {
+		if tp.Topic != nil && *tp.Topic == key.topic && tp.Partition == key.partition {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+var testTopic = "products"
+
+func topicPartition(partition int32, offset kafka.Offset) kafka.TopicPartition {
+	return kafka.TopicPartition{Topic: &testTopic, Partition: partition, Offset: offset}
+}
+
+func TestOffsetTrackerDone(t *testing.T) {
+	tests := []struct {
+		name     string
+		received []kafka.Offset
+		done     []kafka.Offset
+		pending  kafka.Offset
+		inFlight int
+	}{
+		{"in order", []kafka.Offset{10, 11, 12}, []kafka.Offset{10, 11, 12}, 13, 0},
+		{"out of order", []kafka.Offset{10, 11, 12}, []kafka.Offset{12, 11, 10}, 13, 0},
+		{"first still running", []kafka.Offset{10, 11, 12}, []kafka.Offset{11, 12}, -1, 1},
+		{"middle still running", []kafka.Offset{10, 11, 12}, []kafka.Offset{10, 12}, 11, 1},
+		{"gaps in offsets", []kafka.Offset{10, 14, 20}, []kafka.Offset{14, 10}, 15, 1},
+		{"unknown offset", []kafka.Offset{10, 11}, []kafka.Offset{13, 10}, 11, 1},
+		{"repeated completion", []kafka.Offset{10, 11}, []kafka.Offset{10, 10}, 11, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := newOffsetTracker(CommitPolicy{BatchSize: 100, Interval: time.Hour})
+			var assigned *assignment
+			for _, offset := range test.received {
+				assigned = tracker.Track(topicPartition(0, offset))
+			}
+			for _, offset := range test.done {
+				tracker.Done(completion{topicPartition(0, offset), assigned})
+			}
+
+			pending, ok := tracker.pending[partitionKey{testTopic, 0}]
+			if test.pending < 0 && ok {
+				t.Errorf("pending: got %d, want none", pending)
+			}
+			if test.pending >= 0 && pending != test.pending {
+				t.Errorf("pending: got %d (set %v), want %d", pending, ok, test.pending)
+			}
+			if inFlight := tracker.InFlight(nil); inFlight != test.inFlight {
+				t.Errorf("in flight: got %d, want %d", inFlight, test.inFlight)
+			}
+		})
+	}
+}
+
+func TestOffsetTrackerPartitions(t *testing.T) {
+	tracker := newOffsetTracker(CommitPolicy{BatchSize: 100, Interval: time.Hour})
+	first := tracker.Track(topicPartition(0, 5))
+	second := tracker.Track(topicPartition(1, 7))
+	tracker.Track(topicPartition(1, 8))
+
+	tracker.Done(completion{topicPartition(1, 7), second})
+
+	if got := tracker.InFlight([]kafka.TopicPartition{topicPartition(0, kafka.OffsetInvalid)}); got != 1 {
+		t.Errorf("in flight of partition 0: got %d", got)
+	}
+	if got := tracker.InFlight([]kafka.TopicPartition{topicPartition(1, kafka.OffsetInvalid)}); got != 1 {
+		t.Errorf("in flight of partition 1: got %d", got)
+	}
+	if _, ok := tracker.pending[partitionKey{testTopic, 0}]; ok {
+		t.Error("partition 0 advanced with its message running")
+	}
+	if got := tracker.pending[partitionKey{testTopic, 1}]; got != 8 {
+		t.Errorf("pending of partition 1: got %d, want 8", got)
+	}
+
+	tracker.Done(completion{topicPartition(0, 5), first})
+	if got := tracker.pending[partitionKey{testTopic, 0}]; got != 6 {
+		t.Errorf("pending of partition 0: got %d, want 6", got)
+	}
+}
+
+func TestOffsetTrackerRevoke(t *testing.T) {
+	tracker := newOffsetTracker(CommitPolicy{BatchSize: 100, Interval: time.Hour})
+	revoked := tracker.Track(topicPartition(0, 10))
+	tracker.Track(topicPartition(0, 11))
+	tracker.Done(completion{topicPartition(0, 10), revoked})
+
+	tracker.Forget([]kafka.TopicPartition{topicPartition(0, kafka.OffsetInvalid)})
+	if !revoked.Revoked() {
+		t.Error("assignment not revoked")
+	}
+	if len(tracker.pending) != 0 || tracker.InFlight(nil) != 0 {
+		t.Errorf("offsets kept after revoke: pending %v, in flight %d", tracker.pending, tracker.InFlight(nil))
+	}
+
+	reassigned := tracker.Track(topicPartition(0, 11))
+	if reassigned == revoked {
+		t.Fatal("partition got its revoked assignment back")
+	}
+
+	// A message of the earlier assignment finishing late must not complete the redelivered one.
+	tracker.Done(completion{topicPartition(0, 11), revoked})
+	if len(tracker.pending) != 0 || tracker.InFlight(nil) != 1 {
+		t.Errorf("stale completion counted: pending %v, in flight %d", tracker.pending, tracker.InFlight(nil))
+	}
+
+	tracker.Done(completion{topicPartition(0, 11), reassigned})
+	if got := tracker.pending[partitionKey{testTopic, 0}]; got != 12 {
+		t.Errorf("pending: got %d, want 12", got)
+	}
+}
+
+func TestOffsetTrackerDue(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+		interval  time.Duration
+		sinceLast time.Duration
+		done      int
+		due       bool
+	}{
+		{"nothing handled", 1, time.Hour, 2 * time.Hour, 0, false},
+		{"batch not full", 3, time.Hour, 0, 2, false},
+		{"batch full", 3, time.Hour, 0, 3, true},
+		{"interval passed", 100, time.Minute, 2 * time.Minute, 1, true},
+		{"interval not passed", 100, time.Minute, 30 * time.Second, 1, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tracker := newOffsetTracker(CommitPolicy{BatchSize: test.batchSize, Interval: test.interval})
+			tracker.lastCommit = time.Now().Add(-test.sinceLast)
+			for offset := 0; offset < test.done; offset++ {
+				assigned := tracker.Track(topicPartition(0, kafka.Offset(offset)))
+				tracker.Done(completion{topicPartition(0, kafka.Offset(offset)), assigned})
+			}
+
+			if due := tracker.Due(); due != test.due {
+				t.Errorf("got due %v, want %v", due, test.due)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package kafka
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"os"
+	"strings"
+	"time"
+)
+
+// Redrive moves messages from the dead-letter topic of topic back to the topic they came from,
+// without the headers describing their failure. It stops after limit messages, unless limit is 0,
+// or once no message arrived for idleTimeout, and returns how many messages it moved.
+func Redrive(topic string, limit int, idleTimeout time.Duration) (redriven int, err error) {
+	deadLetterTopic := DeadLetterTopic(topic)
+
+	c, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":  os.Getenv("KAFKA_BOOTSTRAP_SERVERS"),
+		"group.id":           os.Getenv("KAFKA_CONSUMER_GROUP") + "-redrive",
+		"session.timeout.ms": 6000,
+		"auto.offset.reset":  "earliest",
+		"enable.auto.commit": false,
+	})
+	if err != nil {
+		logrus.Errorf("Failed to create consumer: %s\n", err)
+		return
+	}
+	defer c.Close()
+
+	err = c.SubscribeTopics([]string{deadLetterTopic}, nil)
+	if err != nil {
+		logrus.Errorf("Failed to subscribe topic: %s\n", err)
+		return
+	}
+
+	idleSince := time.Now()
+	for limit <= 0 || redriven < limit {
+		if time.Since(idleSince) >= idleTimeout {
+			return redriven, nil
+		}
+
+		ev := c.Poll(100)
+		switch e := ev.(type) {
+		case *kafka.Message:
+			idleSince = time.Now()
+
+			target := topic
+			var headers []kafka.Header
+			for _, header := range e.Headers {
+				if header.Key == HeaderDeadLetterTopic {
+					target = string(header.Value)
+				}
+				if !strings.HasPrefix(header.Key, "dead-letter-") {
+					headers = append(headers, header)
+				}
+			}
+			headers = append(headers, kafka.Header{
+				Key:   HeaderDeadLetterRedriveFrom,
+				Value: []byte(fmt.Sprintf("%s[%d]@%s", deadLetterTopic, e.TopicPartition.Partition, e.TopicPartition.Offset)),
+			})
+
+			err = produce(&kafka.Message{
+				TopicPartition: kafka.TopicPartition{Topic: &target, Partition: kafka.PartitionAny},
+				Key:            e.Key,
+				Value:          e.Value,
+				Headers:        headers,
+			})
+			if err != nil {
+				logrus.Errorf("Failed to redrive %s to %s: %s\n", e.TopicPartition, target, err)
+				return
+			}
+
+			_, err = c.CommitMessage(e)
+			if err != nil {
+				logrus.Errorf("Failed to commit %s: %s\n", e.TopicPartition, err)
+				return
+			}
+
+			redriven++
+			logrus.Infof("Redrove %s to %s\n", e.TopicPartition, target)
+		case kafka.Error:
+			logrus.Errorf("%% Error: %v: %v\n", e.Code(), e)
+		}
+	}
+
+	return redriven, nil
+}
@@ -0,0 +1,70 @@
+package kafka
+
+import (
+	"errors"
+	"msrd-products/utils"
+	"time"
+)
+
+// RetryPolicy decides how often a failing message is retried before it is dead-lettered.
+type RetryPolicy struct {
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+}
+
+// RetryPolicyFromEnv reads KAFKA_RETRY_MAX_ATTEMPTS, KAFKA_RETRY_BACKOFF_BASE and KAFKA_RETRY_BACKOFF_MAX.
+func RetryPolicyFromEnv() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: utils.IntEnv("KAFKA_RETRY_MAX_ATTEMPTS", 5),
+		BackoffBase: utils.DurationEnv("KAFKA_RETRY_BACKOFF_BASE", 500*time.Millisecond),
+		BackoffMax:  utils.DurationEnv("KAFKA_RETRY_BACKOFF_MAX", 30*time.Second),
+	}
+}
+
+// Backoff returns the delay after the given number of failed attempts, doubling from BackoffBase up to BackoffMax.
+func (policy RetryPolicy) Backoff(attempts int) time.Duration {
+	delay := policy.BackoffBase
+	for i := 1; i < attempts && delay < policy.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > policy.BackoffMax {
+		delay = policy.BackoffMax
+	}
+	return delay
+}
+
+type fatalError struct {
+	err error
+}
+
+func (e fatalError) Error() string {
+	return e.err.Error()
+}
+
+func (e fatalError) Unwrap() error {
+	return e.err
+}
+
+// Fatal marks an error that retrying cannot fix, such as an invalid payload,
+// so the message is dead-lettered right away.
+func Fatal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fatalError{err}
+}
+
+// IsRetryable classifies an error returned while handling a message. Errors are assumed to be
+// transient, like database timeouts, unless they are marked Fatal.
+func IsRetryable(err error) bool {
+	var fatal fatalError
+	return !errors.As(err, &fatal)
+}
+
+func errorClass(err error) string {
+	if IsRetryable(err) {
+		return "retryable"
+	}
+	return "fatal"
+}
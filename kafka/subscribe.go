@@ -1,18 +1,67 @@
 package kafka
 
 import (
+	"errors"
 	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/schemaregistry"
 	"github.com/confluentinc/confluent-kafka-go/schemaregistry/serde"
 	"github.com/confluentinc/confluent-kafka-go/schemaregistry/serde/avro"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+	"msrd-products/utils"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
-func Subscribe[T interface{}](topic string, onMessage func(message T) bool) error {
+// Headers holds the headers of a consumed message. A repeated key keeps its last value.
+type Headers map[string]string
+
+func messageHeaders(headers []kafka.Header) Headers {
+	result := Headers{}
+	for _, header := range headers {
+		result[header.Key] = string(header.Value)
+	}
+	return result
+}
+
+// Metadata locates a consumed message in its topic and carries its headers.
+type Metadata struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Headers   Headers
+}
+
+func messageMetadata(message *kafka.Message) Metadata {
+	metadata := Metadata{
+		Partition: message.TopicPartition.Partition,
+		Offset:    int64(message.TopicPartition.Offset),
+		Headers:   messageHeaders(message.Headers),
+	}
+	if message.TopicPartition.Topic != nil {
+		metadata.Topic = *message.TopicPartition.Topic
+	}
+	return metadata
+}
+
+// Subscribe hands each message of the topic to onMessage, keeping the order of messages with the same
+// Kafka message key. See SubscribeOrdered.
+func Subscribe[T interface{}](topic string, onMessage func(message T, metadata Metadata) error) error {
+	return SubscribeOrdered[T](topic, nil, onMessage)
+}
+
+// SubscribeOrdered hands each message of the topic to onMessage on KAFKA_WORKERS workers. Messages with
+// the same ordering key are handled one after another in topic order, others in parallel. The key is
+// taken from the decoded message by key, or is the Kafka message key when key is nil.
+//
+// Failing messages are retried by the retry policy unless the error is Fatal, and then copied to the
+// dead-letter topic, so every message is either handled or dead-lettered before its offset is committed.
+// Offsets only advance past messages that completed together with all earlier ones of their partition.
+// They are committed in batches by the commit policy, and right away when partitions are revoked or
+// the consumer stops.
+func SubscribeOrdered[T interface{}](topic string, key func(message T) string, onMessage func(message T, metadata Metadata) error) error {
 	var bootstrapServers = os.Getenv("KAFKA_BOOTSTRAP_SERVERS")
 	var group = os.Getenv("KAFKA_CONSUMER_GROUP")
 	var schmaregistryUrl = os.Getenv("KAFKA_SCHEMAREGISTRY_CLIENT")
@@ -27,27 +76,75 @@ func Subscribe[T interface{}](topic string, onMessage func(message T) bool) erro
 
 	defer c.Close()
 	if err != nil {
-		logrus.Errorln(os.Stderr, "Failed to create consumer: %s\n", err)
+		logrus.Errorf("Failed to create consumer: %s\n", err)
 		return err
 	}
 
-	logrus.Infoln("Created Consumer %v\n", c)
+	logrus.Infof("Created Consumer %v\n", c)
 	client, err := schemaregistry.NewClient(schemaregistry.NewConfig(schmaregistryUrl))
 
 	if err != nil {
-		logrus.Errorln("Failed to create schema registry client: %s\n", err)
+		logrus.Errorf("Failed to create schema registry client: %s\n", err)
 		return err
 	}
 
 	deser, err := avro.NewGenericDeserializer(client, serde.ValueSerde, avro.NewDeserializerConfig())
 	if err != nil {
-		logrus.Errorln("Failed to create deserializer: %s\n", err)
+		logrus.Errorf("Failed to create deserializer: %s\n", err)
 		return err
 	}
 
-	err = c.SubscribeTopics([]string{topic}, nil)
+	policy := RetryPolicyFromEnv()
+	revokeTimeout := utils.DurationEnv("KAFKA_REVOKE_TIMEOUT", 10*time.Second)
+	offsets := newOffsetTracker(CommitPolicyFromEnv())
+	pool := newWorkerPool[T](WorkersFromEnv(), func(j job[T], stop <-chan struct{}) error {
+		return handleMessage(j, onMessage, policy, stop)
+	})
+	dispatcher := newBacklogDispatcher(pool, func(pause bool) bool {
+		return setPaused(c, pause)
+	})
+	stopped := false
+
+	// Runs before the deferred Close, so handled messages are committed on every way out.
+	defer func() {
+		if !stopped {
+			stopped = true
+			pool.Stop(offsets.Done)
+		}
+		_ = offsets.Commit(c, nil)
+	}()
+
+	// Revoked partitions are finished and committed before another consumer takes them over, waiting
+	// at most revokeTimeout for messages that are being handled. Messages still running after that, or
+	// waiting in the backlog, are abandoned and left to the next owner. Partitions that were lost may
+	// already belong to another consumer, so their offsets are dropped.
+	err = c.SubscribeTopics([]string{topic}, func(c *kafka.Consumer, event kafka.Event) error {
+		dispatcher.Rebalanced()
+		revoked, ok := event.(kafka.RevokedPartitions)
+		if !ok {
+			return nil
+		}
+
+		if !c.AssignmentLost() {
+			waiting := dispatcher.Waiting(revoked.Partitions)
+			deadline := time.After(revokeTimeout)
+		finishing:
+			for !stopped && offsets.InFlight(revoked.Partitions) > waiting {
+				select {
+				case done := <-pool.done:
+					offsets.Done(done)
+				case <-deadline:
+					logrus.Warnf("%% Abandoning %d messages of revoked partitions after %s\n", offsets.InFlight(revoked.Partitions)-waiting, revokeTimeout)
+					break finishing
+				}
+			}
+			_ = offsets.Commit(c, revoked.Partitions)
+		}
+		offsets.Forget(revoked.Partitions)
+		return nil
+	})
 	if err != nil {
-		logrus.Errorln("Failed to subscribe topic: %s\n", err)
+		logrus.Errorf("Failed to subscribe topic: %s\n", err)
 		return err
 	}
 
@@ -57,41 +154,129 @@ func Subscribe[T interface{}](topic string, onMessage func(message T) bool) erro
 	for true {
 		select {
 		case sig := <-sigchan:
-			logrus.Infoln("Caught signal %v: terminating\n", sig)
+			logrus.Infof("Caught signal %v: terminating\n", sig)
+			stopped = true
+			pool.Stop(offsets.Done)
 			return nil
+		case done := <-pool.done:
+			offsets.Done(done)
+		case err := <-pool.failed:
+			logrus.Errorf("%% Stopping consumer of %s: %s\n", topic, err)
+			stopped = true
+			pool.Stop(offsets.Done)
+			return err
 		default:
 			ev := c.Poll(100)
-			if ev == nil {
-				continue
-			}
 
 			switch e := ev.(type) {
 			case *kafka.Message:
-
-				var value T
-				err := deser.DeserializeInto(*e.TopicPartition.Topic, e.Value, &value)
-				if err != nil {
-					logrus.Errorln("Failed to deserialize payload: %s\n", err)
-				} else {
-					logrus.Infoln("%% Message on %s:\n%+v\n", e.TopicPartition, value)
-					if onMessage(value) {
-						go c.Commit()
-						logrus.Infoln("%% Committed on %s:\n%+v\n", e.TopicPartition, value)
-					}
-
-					logrus.Warnln("%% Commit cancelled on %s:\n%+v\n", e.TopicPartition, value)
-				}
-				if e.Headers != nil {
-					logrus.Infoln("%% Headers: %v\n", e.Headers)
+				j := job[T]{message: e, key: string(e.Key)}
+				j.err = deser.DeserializeInto(*e.TopicPartition.Topic, e.Value, &j.value)
+				if key != nil && j.err == nil {
+					j.key = key(j.value)
 				}
+
+				j.assignment = offsets.Track(e.TopicPartition)
+				dispatcher.Add(j)
+			case nil:
 			case kafka.Error:
-				logrus.Errorln("%% Error: %v: %v\n", e.Code(), e)
+				logrus.Errorf("%% Error: %v: %v\n", e.Code(), e)
 			default:
-				logrus.Infoln("Ignored %v\n", e)
+				logrus.Infof("Ignored %v\n", e)
 			}
+
+			dispatcher.Flush()
+		}
+
+		if offsets.Due() {
+			_ = offsets.Commit(c, nil)
 		}
 	}
 
 	fmt.Printf("Closing consumer\n")
 	return nil
 }
+
+// setPaused pauses or resumes fetching from the assigned partitions and reports whether it succeeded.
+func setPaused(c *kafka.Consumer, pause bool) bool {
+	partitions, err := c.Assignment()
+	if err == nil {
+		if pause {
+			err = c.Pause(partitions)
+		} else {
+			err = c.Resume(partitions)
+		}
+	}
+	if err != nil {
+		logrus.Errorf("%% Failed to pause or resume %v: %s\n", partitions, err)
+		return false
+	}
+	return true
+}
+
+// errAbandoned reports a message left unhandled because the consumer is stopping or its partition was revoked.
+var errAbandoned = errors.New("message abandoned")
+
+// handleMessage runs onMessage until it succeeds, fails fatally or runs out of attempts, and dead-letters
+// the message if it did not succeed. Dead-lettering is retried by the same policy; when it keeps failing
+// the message is neither handled nor dead-lettered and ErrDeadLetterFailed is returned to stop the
+// consumer. It returns errAbandoned when the consumer stopped or the partition was revoked while waiting,
+// leaving the message uncommitted.
+func handleMessage[T interface{}](j job[T], onMessage func(message T, metadata Metadata) error, policy RetryPolicy, stop <-chan struct{}) error {
+	e := j.message
+	attempts := 1
+	err := j.err
+
+	if err != nil {
+		err = Fatal(fmt.Errorf("failed to deserialize payload: %w", err))
+	} else {
+		logrus.Infof("%% Message on %s:\n%+v\n", e.TopicPartition, j.value)
+		for {
+			err = onMessage(j.value, messageMetadata(e))
+			if err == nil || !IsRetryable(err) || attempts >= policy.MaxAttempts {
+				break
+			}
+
+			delay := policy.Backoff(attempts)
+			logrus.Warnf("%% Attempt %d on %s failed, retrying in %s: %s\n", attempts, e.TopicPartition, delay, err)
+			if !wait(delay, stop, j.assignment.revoked) {
+				logrus.Infof("Abandoning %s\n", e.TopicPartition)
+				return errAbandoned
+			}
+			attempts++
+		}
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	logrus.Errorf("%% Dead-lettering %s after %d attempts (%s): %s\n", e.TopicPartition, attempts, errorClass(err), err)
+	var dlErr error
+	for try := 1; try <= policy.MaxAttempts; try++ {
+		dlErr = publishDeadLetter(e, err, attempts)
+		if dlErr == nil {
+			return nil
+		}
+
+		logrus.Errorf("%% %s\n", dlErr)
+		if try < policy.MaxAttempts && !wait(policy.Backoff(try), stop, j.assignment.revoked) {
+			logrus.Infof("Abandoning %s\n", e.TopicPartition)
+			return errAbandoned
+		}
+	}
+
+	return fmt.Errorf("%w %s: %s", ErrDeadLetterFailed, e.TopicPartition, dlErr)
+}
+
+// wait sleeps for the delay and reports false if the consumer stopped or the partition was revoked first.
+func wait(delay time.Duration, stop <-chan struct{}, revoked <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return false
+	case <-revoked:
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
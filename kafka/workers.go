@@ -0,0 +1,209 @@
+package kafka
+
+import (
+	"hash/fnv"
+	"msrd-products/utils"
+	"sync"
+
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+// workerQueueSize bounds the messages waiting for each worker.
+const workerQueueSize = 64
+
+// assignment is one period in which a partition is assigned to this consumer. It is revoked when the
+// partition is taken away, so work still queued or retrying for it is abandoned and completions that
+// arrive late are not mistaken for those of a later assignment.
+type assignment struct {
+	revoked chan struct{}
+}
+
+func newAssignment() *assignment {
+	return &assignment{revoked: make(chan struct{})}
+}
+
+func (a *assignment) Revoke() {
+	close(a.revoked)
+}
+
+func (a *assignment) Revoked() bool {
+	select {
+	case <-a.revoked:
+		return true
+	default:
+		return false
+	}
+}
+
+// job is a consumed message with its decoded value, or the error decoding it, and its ordering key.
+type job[T interface{}] struct {
+	message    *kafka.Message
+	value      T
+	err        error
+	key        string
+	assignment *assignment
+}
+
+// completion reports a handled message of a partition assignment.
+type completion struct {
+	tp         kafka.TopicPartition
+	assignment *assignment
+}
+
+// workerPool handles messages on several goroutines. Messages with the same ordering key always go to
+// the same worker, so they are handled in the order they were consumed. Handled messages are reported
+// on done; messages abandoned after stop or after their assignment was revoked are not. Other errors
+// are reported on failed, and the worker carries on so the caller can stop the pool.
+type workerPool[T interface{}] struct {
+	queues []chan job[T]
+	done   chan completion
+	failed chan error
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// WorkersFromEnv reads KAFKA_WORKERS, the number of messages a consumer handles in parallel.
+func WorkersFromEnv() int {
+	workers := utils.IntEnv("KAFKA_WORKERS", 4)
+	if workers < 1 {
+		return 1
+	}
+	return workers
+}
+
+func newWorkerPool[T interface{}](size int, handle func(job job[T], stop <-chan struct{}) error) *workerPool[T] {
+	pool := &workerPool[T]{
+		queues: make([]chan job[T], size),
+		done:   make(chan completion, size*(workerQueueSize+1)),
+		failed: make(chan error, size),
+		stop:   make(chan struct{}),
+	}
+
+	for i := range pool.queues {
+		queue := make(chan job[T], workerQueueSize)
+		pool.queues[i] = queue
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for j := range queue {
+				if pool.stopped() || j.assignment.Revoked() {
+					continue
+				}
+				switch err := handle(j, pool.stop); err {
+				case nil:
+					pool.done <- completion{j.message.TopicPartition, j.assignment}
+				case errAbandoned:
+				default:
+					select {
+					case pool.failed <- err:
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	return pool
+}
+
+func (pool *workerPool[T]) stopped() bool {
+	select {
+	case <-pool.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// TryDispatch queues a job on the worker for its key, and reports false without waiting when that
+// worker's queue is full.
+func (pool *workerPool[T]) TryDispatch(j job[T]) bool {
+	hash := fnv.New32a()
+	hash.Write([]byte(j.key))
+
+	select {
+	case pool.queues[hash.Sum32()%uint32(len(pool.queues))] <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+// backlogDispatcher hands consumed messages to a worker pool in the order they were consumed. Messages
+// wait in the backlog while the worker for their key is busy, and pause fetches the assigned partitions
+// meanwhile, so the consumer keeps polling and stays in the group without reading further ahead.
+type backlogDispatcher[T interface{}] struct {
+	pool    *workerPool[T]
+	pause   func(pause bool) bool
+	backlog []job[T]
+	paused  bool
+}
+
+func newBacklogDispatcher[T interface{}](pool *workerPool[T], pause func(pause bool) bool) *backlogDispatcher[T] {
+	return &backlogDispatcher[T]{pool: pool, pause: pause}
+}
+
+func (d *backlogDispatcher[T]) Add(j job[T]) {
+	d.backlog = append(d.backlog, j)
+}
+
+// Flush dispatches the backlog in order, so messages with the same key cannot overtake each other,
+// and drops messages of revoked assignments. It pauses the partitions while messages are left waiting
+// and resumes them once the backlog is empty; a failed pause or resume is retried on the next flush.
+func (d *backlogDispatcher[T]) Flush() {
+	for len(d.backlog) > 0 && (d.backlog[0].assignment.Revoked() || d.pool.TryDispatch(d.backlog[0])) {
+		d.backlog = d.backlog[1:]
+	}
+
+	if len(d.backlog) > 0 && !d.paused {
+		d.paused = d.pause(true)
+	} else if len(d.backlog) == 0 && d.paused {
+		d.paused = !d.pause(false)
+	}
+}
+
+// Waiting counts the messages of the given partitions left in the backlog.
+func (d *backlogDispatcher[T]) Waiting(partitions []kafka.TopicPartition) (count int) {
+	for _, j := range d.backlog {
+		if containsPartition(partitions, partitionKey{*j.message.TopicPartition.Topic, j.message.TopicPartition.Partition}) {
+			count++
+		}
+	}
+	return
+}
+
+// Rebalanced records that a rebalance resumed fetching from all assigned partitions.
+func (d *backlogDispatcher[T]) Rebalanced() {
+	d.paused = false
+}
+
+// Stop abandons queued messages and retries, waits for the workers to finish the messages they are
+// handling and passes the last completions to completed.
+func (pool *workerPool[T]) Stop(completed func(done completion)) {
+	close(pool.stop)
+	for _, queue := range pool.queues {
+		close(queue)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		pool.wg.Wait()
+		close(finished)
+	}()
+
+	for {
+		select {
+		case done := <-pool.done:
+			completed(done)
+		case <-finished:
+			for {
+				select {
+				case done := <-pool.done:
+					completed(done)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package kafka
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/confluentinc/confluent-kafka-go.v1/kafka"
+)
+
+func testJob(key string, value int, offset kafka.Offset, assigned *assignment) job[int] {
+	return job[int]{
+		message:    &kafka.Message{TopicPartition: topicPartition(0, offset)},
+		value:      value,
+		key:        key,
+		assignment: assigned,
+	}
+}
+
+// awaitCompletions reads n completions off the pool, as the consumer loop does, and fails after a timeout.
+func awaitCompletions(t *testing.T, pool *workerPool[int], n int, flush func()) {
+	completed := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			<-pool.done
+		}
+		close(completed)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		flush()
+		select {
+		case <-completed:
+			return
+		case <-deadline:
+			t.Fatalf("timed out waiting for %d completions", n)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestWorkerPoolKeyOrder(t *testing.T) {
+	var mutex sync.Mutex
+	handled := map[string][]int{}
+	pool := newWorkerPool[int](4, func(j job[int], stop <-chan struct{}) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		handled[j.key] = append(handled[j.key], j.value)
+		return nil
+	})
+
+	assigned := newAssignment()
+	dispatcher := newBacklogDispatcher(pool, func(pause bool) bool { return true })
+	for i := 0; i < 300; i++ {
+		dispatcher.Add(testJob(fmt.Sprintf("key-%d", i%5), i, kafka.Offset(i), assigned))
+		dispatcher.Flush()
+	}
+	awaitCompletions(t, pool, 300, dispatcher.Flush)
+	pool.Stop(func(done completion) {})
+
+	for key, values := range handled {
+		for i := 1; i < len(values); i++ {
+			if values[i] < values[i-1] {
+				t.Errorf("%s: handled %d after %d", key, values[i], values[i-1])
+				break
+			}
+		}
+	}
+}
+
+func TestBacklogDispatcherPause(t *testing.T) {
+	release := make(chan struct{})
+	var mutex sync.Mutex
+	var handled []int
+	pool := newWorkerPool[int](1, func(j job[int], stop <-chan struct{}) error {
+		<-release
+		mutex.Lock()
+		defer mutex.Unlock()
+		handled = append(handled, j.value)
+		return nil
+	})
+
+	var pauses []bool
+	failPause := true
+	dispatcher := newBacklogDispatcher(pool, func(pause bool) bool {
+		pauses = append(pauses, pause)
+		if failPause {
+			failPause = false
+			return false
+		}
+		return true
+	})
+
+	assigned := newAssignment()
+	messages := workerQueueSize + 10
+	for i := 0; i < messages; i++ {
+		dispatcher.Add(testJob("same", i, kafka.Offset(i), assigned))
+	}
+
+	dispatcher.Flush()
+	if len(dispatcher.backlog) == 0 || dispatcher.paused {
+		t.Fatalf("after a failed pause: backlog %d, paused %v", len(dispatcher.backlog), dispatcher.paused)
+	}
+	dispatcher.Flush()
+	if !dispatcher.paused {
+		t.Fatal("full worker did not pause the partitions")
+	}
+	dispatcher.Flush()
+	if len(pauses) != 2 {
+		t.Errorf("got pause calls %v, want the failed pause retried once", pauses)
+	}
+
+	close(release)
+	awaitCompletions(t, pool, messages, dispatcher.Flush)
+	if dispatcher.paused || len(dispatcher.backlog) != 0 {
+		t.Fatalf("backlog %d, paused %v after the worker caught up", len(dispatcher.backlog), dispatcher.paused)
+	}
+	if len(pauses) != 3 || pauses[2] {
+		t.Errorf("got pause calls %v, want a resume last", pauses)
+	}
+
+	pool.Stop(func(done completion) {})
+	if len(handled) != messages {
+		t.Fatalf("handled %d messages, want %d", len(handled), messages)
+	}
+	for i, value := range handled {
+		if value != i {
+			t.Fatalf("handled %v, want consumption order", handled)
+		}
+	}
+}
+
+func TestBacklogDispatcherRevoked(t *testing.T) {
+	release := make(chan struct{})
+	pool := newWorkerPool[int](1, func(j job[int], stop <-chan struct{}) error {
+		<-release
+		return nil
+	})
+	dispatcher := newBacklogDispatcher(pool, func(pause bool) bool { return true })
+
+	revoked := newAssignment()
+	for i := 0; i < workerQueueSize+10; i++ {
+		dispatcher.Add(testJob("same", i, kafka.Offset(i), revoked))
+	}
+	dispatcher.Flush()
+
+	partition := []kafka.TopicPartition{topicPartition(0, kafka.OffsetInvalid)}
+	if dispatcher.Waiting(partition) == 0 || !dispatcher.paused {
+		t.Fatalf("waiting %d, paused %v", dispatcher.Waiting(partition), dispatcher.paused)
+	}
+
+	revoked.Revoke()
+	dispatcher.Flush()
+	if dispatcher.Waiting(partition) != 0 || dispatcher.paused {
+		t.Errorf("revoked messages kept: waiting %d, paused %v", dispatcher.Waiting(partition), dispatcher.paused)
+	}
+
+	close(release)
+	completed := 0
+	pool.Stop(func(done completion) { completed++ })
+	if completed > 1 {
+		t.Errorf("got %d completions of a revoked assignment", completed)
+	}
+}
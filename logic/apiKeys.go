@@ -0,0 +1,243 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"msrd-products/auth"
+	"msrd-products/db"
+	"msrd-products/models"
+	"time"
+)
+
+const apiKeyPrefix = "msrd_"
+
+type ApiKeysRepository interface {
+	Issue(request models.CreateApiKeyRequest) (*models.IssuedApiKey, error)
+	FindById(id string) (*models.ApiKey, error)
+	Rotate(id string, grace time.Duration) (*models.IssuedApiKey, error)
+	Revoke(id string) (*models.ApiKey, error)
+	List() ([]models.ApiKey, error)
+	Authenticate(key string, lastUsedResolution time.Duration) (*models.ApiKey, error)
+}
+
+type apiKeysRepository struct {
+	collection *mongo.Collection
+	context    context.Context
+}
+
+func NewApiKeysRepository(context context.Context, dbContext db.DbContext) ApiKeysRepository {
+	return &apiKeysRepository{dbContext.GetApiKeysCollection(), context}
+}
+
+// Issue stores a new key for the tenant and actor of the context and returns it in plain text.
+func (r apiKeysRepository) Issue(request models.CreateApiKeyRequest) (issued *models.IssuedApiKey, err error) {
+	apiKey := models.ApiKey{
+		Name:      request.Name,
+		Scopes:    request.Scopes,
+		ExpiresAt: request.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	apiKey.TenantId, _ = auth.TenantFromContext(r.context)
+	if actor, ok := auth.ActorFromContext(r.context); ok {
+		apiKey.CreatedBy = &actor
+	}
+
+	return r.insert(apiKey)
+}
+
+// FindById returns ErrApiKeyNotFound for unknown keys and keys of other tenants.
+func (r apiKeysRepository) FindById(id string) (apiKey *models.ApiKey, err error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrApiKeyNotFound
+	}
+
+	err = r.collection.FindOne(r.context, scopeToTenant(r.context, bson.M{"_id": oid})).Decode(&apiKey)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrApiKeyNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return
+}
+
+// Rotate issues a key with the same name, scopes and expiry as the given one. The old key keeps
+// working for the grace period so callers can switch over, and then expires. A key can be rotated
+// only once, so concurrent rotations of the same key leave one replacement and ErrApiKeyRotated.
+func (r apiKeysRepository) Rotate(id string, grace time.Duration) (issued *models.IssuedApiKey, err error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrApiKeyNotFound
+	}
+
+	var current models.ApiKey
+	err = r.collection.FindOne(r.context, scopeToTenant(r.context, bson.M{"_id": oid, "revoked_at": nil})).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrApiKeyNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if current.ReplacedBy != nil {
+		return nil, ErrApiKeyRotated
+	}
+
+	replacement := current
+	replacement.Id = primitive.NilObjectID
+	replacement.CreatedAt = time.Now()
+	replacement.LastUsedAt = nil
+	replacement.ReplacedBy = nil
+	if actor, ok := auth.ActorFromContext(r.context); ok {
+		replacement.CreatedBy = &actor
+	}
+
+	issued, err = r.insert(replacement)
+	if err != nil {
+		return
+	}
+
+	expiresAt := replacement.CreatedAt.Add(grace)
+	if current.ExpiresAt != nil && current.ExpiresAt.Before(expiresAt) {
+		expiresAt = *current.ExpiresAt
+	}
+
+	res, err := r.collection.UpdateOne(r.context, bson.M{"_id": oid, "revoked_at": nil, "replaced_by": nil}, bson.M{
+		"$set": bson.M{"expires_at": expiresAt, "replaced_by": issued.Id},
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	// Another rotation or a revocation got there first, so the new key must not stay usable.
+	if res.MatchedCount == 0 {
+		if _, err = r.collection.DeleteOne(r.context, bson.M{"_id": issued.Id}); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		return nil, ErrApiKeyRotated
+	}
+
+	return
+}
+
+// Revoke returns ErrApiKeyRevoked for keys that are already revoked, keeping their revocation time.
+func (r apiKeysRepository) Revoke(id string) (apiKey *models.ApiKey, err error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrApiKeyNotFound
+	}
+
+	err = r.collection.FindOneAndUpdate(r.context,
+		scopeToTenant(r.context, bson.M{"_id": oid, "revoked_at": nil}),
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&apiKey)
+
+	if err == mongo.ErrNoDocuments {
+		if _, err = r.FindById(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrApiKeyRevoked
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return
+}
+
+func (r apiKeysRepository) List() (apiKeys []models.ApiKey, err error) {
+	curs, err := r.collection.Find(r.context, scopeToTenant(r.context, bson.M{}),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	apiKeys = []models.ApiKey{}
+	err = curs.All(r.context, &apiKeys)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return
+}
+
+// Authenticate returns the live key matching the plain key. Last use is recorded at most
+// once per lastUsedResolution, so busy callers do not cause a write per request.
+func (r apiKeysRepository) Authenticate(key string, lastUsedResolution time.Duration) (apiKey *models.ApiKey, err error) {
+	now := time.Now()
+
+	err = r.collection.FindOne(r.context, bson.M{"hash": hashApiKey(key), "revoked_at": nil}).Decode(&apiKey)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrApiKeyInvalid
+	}
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if apiKey.ExpiresAt != nil && !now.Before(*apiKey.ExpiresAt) {
+		return nil, ErrApiKeyInvalid
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= lastUsedResolution {
+		_, err = r.collection.UpdateOne(r.context, bson.M{"_id": apiKey.Id}, bson.M{"$set": bson.M{"last_used_at": now}})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		apiKey.LastUsedAt = &now
+	}
+
+	return
+}
+
+func (r apiKeysRepository) insert(apiKey models.ApiKey) (issued *models.IssuedApiKey, err error) {
+	key, prefix, err := generateApiKey()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	apiKey.Prefix = prefix
+	apiKey.Hash = hashApiKey(key)
+
+	res, err := r.collection.InsertOne(r.context, apiKey)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	apiKey.Id = res.InsertedID.(primitive.ObjectID)
+
+	return &models.IssuedApiKey{ApiKey: apiKey, Key: key}, nil
+}
+
+// generateApiKey returns a random key and the leading part of it that identifies the key in listings.
+func generateApiKey() (key string, prefix string, err error) {
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return
+	}
+	key = apiKeyPrefix + hex.EncodeToString(secret)
+	return key, key[:len(apiKeyPrefix)+8], nil
+}
+
+func hashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,230 @@
+package logic
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"msrd-products/models"
+	"msrd-products/utils"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultAsOfMaxCandidates = 5000
+
+// findByIdAsOf rebuilds a product as it was at asOf, returning nil when it did not exist yet.
+func (r productRepository) findByIdAsOf(id primitive.ObjectID, asOf time.Time) (product *models.Product, err error) {
+	var document bson.M
+	err = r.collection.FindOne(r.context, r.scoped(bson.M{"_id": id})).Decode(&document)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	documents, err := r.rewind([]bson.M{document}, asOf)
+	if err != nil || len(documents) == 0 {
+		return
+	}
+
+	return decodeProduct(documents[0])
+}
+
+// queryProductsAsOf pages through products as they were at asOf. Every product created by then
+// has to be rebuilt before it can be filtered and sorted, so the number of candidates is capped
+// by AS_OF_QUERY_MAX_CANDIDATES and larger queries fail with ErrAsOfQueryTooBroad.
+func (r productRepository) queryProductsAsOf(request models.QueryRequest, readOptions ReadOptions) (err error, response models.QueryResponse[models.Product]) {
+	asOf := *readOptions.AsOf
+	filter := r.scoped(bson.M{"created_at": bson.M{"$lte": asOf}})
+
+	candidates, err := r.collection.CountDocuments(r.context, filter)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if candidates > int64(utils.IntEnv("AS_OF_QUERY_MAX_CANDIDATES", defaultAsOfMaxCandidates)) {
+		return ErrAsOfQueryTooBroad, response
+	}
+
+	curs, err := r.collection.Find(r.context, filter)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	var documents []bson.M
+	err = curs.All(r.context, &documents)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	documents, err = r.rewind(documents, asOf)
+	if err != nil {
+		return
+	}
+
+	visible := []bson.M{}
+	for _, document := range documents {
+		if document["deleted"] != true || readOptions.IncludeDeleted {
+			visible = append(visible, document)
+		}
+	}
+
+	if request.SortField != "" && request.SortOrder != 0 {
+		sort.SliceStable(visible, func(i, j int) bool {
+			return compareValues(visible[i][request.SortField], visible[j][request.SortField])*request.SortOrder < 0
+		})
+	}
+
+	response.Result = []models.Product{}
+	for i := request.Offset; i < int64(len(visible)) && i < request.Offset+request.Rows; i++ {
+		var product *models.Product
+		product, err = decodeProduct(visible[i])
+		if err != nil {
+			return
+		}
+		response.Result = append(response.Result, *product)
+	}
+
+	paginate(request, int64(len(visible)), &response)
+
+	return
+}
+
+// rewind rebuilds current product documents as they were at asOf, dropping those that did not exist yet.
+func (r productRepository) rewind(documents []bson.M, asOf time.Time) (rewound []bson.M, err error) {
+	ids := make([]primitive.ObjectID, 0, len(documents))
+	for _, document := range documents {
+		ids = append(ids, document["_id"].(primitive.ObjectID))
+	}
+
+	changes, err := r.history.ChangesSince(ids, asOf)
+	if err != nil {
+		return
+	}
+
+	lastChangedAt, err := r.history.LastChangedAt(ids, asOf)
+	if err != nil {
+		return
+	}
+
+	for _, document := range documents {
+		id := document["_id"].(primitive.ObjectID)
+		if !rewindDocument(document, changes[id], asOf) {
+			continue
+		}
+		if changedAt, ok := lastChangedAt[id]; ok {
+			document["updated_at"] = primitive.NewDateTimeFromTime(changedAt)
+		}
+		rewound = append(rewound, document)
+	}
+
+	return
+}
+
+// rewindDocument reverts, newest first, the changes written after asOf and reports whether the product
+// existed at that moment. A field is removed only if it did not exist before the change; older
+// entries without existence flags fall back to a missing before value. Products older than their
+// history get created_at as updated_at when rewound past their first entry, because the time of
+// earlier updates was never recorded.
+func rewindDocument(document bson.M, later []models.ProductHistoryEntry, asOf time.Time) bool {
+	if createdAt, ok := document["created_at"].(primitive.DateTime); ok && createdAt.Time().After(asOf) {
+		return false
+	}
+
+	for _, entry := range later {
+		if entry.Operation == models.HistoryOpCreate {
+			return false
+		}
+		for _, change := range entry.Changes {
+			if change.BeforeExists || change.Before != nil {
+				document[change.Field] = change.Before
+			} else {
+				delete(document, change.Field)
+			}
+		}
+		document["version"] = entry.Version - 1
+		document["updated_at"] = document["created_at"]
+	}
+
+	return true
+}
+
+// compareValues orders document values the way MongoDB sorts them:
+// missing values first, then numbers, strings, booleans and dates.
+func compareValues(a interface{}, b interface{}) int {
+	rankA, rankB := valueRank(a), valueRank(b)
+	if rankA != rankB {
+		return rankA - rankB
+	}
+
+	switch a := a.(type) {
+	case nil:
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		if a == b.(bool) {
+			return 0
+		}
+		if a {
+			return 1
+		}
+		return -1
+	case primitive.DateTime:
+		switch other := b.(primitive.DateTime); {
+		case a < other:
+			return -1
+		case a > other:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	if rankA == 1 {
+		return numberDecimal(a).Cmp(numberDecimal(b))
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func valueRank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case int32, int64, float64, primitive.Decimal128:
+		return 1
+	case string:
+		return 2
+	case bool:
+		return 3
+	case primitive.DateTime:
+		return 4
+	default:
+		return 5
+	}
+}
+
+func numberDecimal(value interface{}) (decimal models.Decimal) {
+	switch number := value.(type) {
+	case int32:
+		decimal, _ = models.ParseDecimal(strconv.FormatInt(int64(number), 10))
+	case int64:
+		decimal, _ = models.ParseDecimal(strconv.FormatInt(number, 10))
+	case float64:
+		decimal, _ = models.DecimalFromFloat(number)
+	case primitive.Decimal128:
+		decimal, _ = models.ParseDecimal(number.String())
+	}
+	return
+}
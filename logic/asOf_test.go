@@ -0,0 +1,41 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"msrd-products/models"
+)
+
+func TestRewindDocumentKeepsNulls(t *testing.T) {
+	before := bson.M{"name": "product", "description": nil, "version": int64(1)}
+	after := bson.M{"name": "product", "description": "text", "unit": "kg", "version": int64(2)}
+
+	changes := diffDocuments(before, after)
+	if len(changes) != 2 {
+		t.Fatalf("got changes %+v", changes)
+	}
+
+	document := bson.M{}
+	for field, value := range after {
+		document[field] = value
+	}
+	later := []models.ProductHistoryEntry{{Version: 2, Operation: models.HistoryOpUpdate, Changes: changes}}
+	if !rewindDocument(document, later, time.Now()) {
+		t.Fatal("product did not exist")
+	}
+
+	if value, ok := document["description"]; !ok || value != nil {
+		t.Errorf("description: got %v (exists %v), want null", value, ok)
+	}
+	if _, ok := document["unit"]; ok {
+		t.Errorf("unit: got %v, want missing", document["unit"])
+	}
+
+	legacy := bson.M{"unit": "kg"}
+	rewindDocument(legacy, []models.ProductHistoryEntry{{Version: 2, Changes: []models.FieldChange{{Field: "unit", After: "kg"}}}}, time.Now())
+	if _, ok := legacy["unit"]; ok {
+		t.Errorf("legacy entry: got unit %v, want missing", legacy["unit"])
+	}
+}
@@ -0,0 +1,150 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"msrd-products/db"
+	"msrd-products/models"
+	"net/http"
+)
+
+var errBatchOperationFailed = errors.New("batch operation failed")
+
+// ExecuteProductBatch runs a mixed list of product operations. In atomic mode all operations run
+// in one transaction and the first failure rolls every one of them back; in best-effort mode
+// each operation is applied on its own. Each result carries an HTTP-like status.
+func ExecuteProductBatch(ctx context.Context, dbContext db.DbContext, request models.BatchRequest) (response models.BatchResponse, err error) {
+	response.Mode = request.Mode
+	if response.Mode == "" {
+		response.Mode = models.BatchModeAtomic
+	}
+
+	if response.Mode == models.BatchModeBestEffort {
+		prodRep := NewProductsRepository(ctx, dbContext)
+		for i, operation := range request.Operations {
+			var result models.BatchOperationResult
+			result, err = executeBatchOperation(prodRep, i, operation)
+			if err != nil {
+				return
+			}
+			response.Results = append(response.Results, result)
+		}
+		response.Committed = true
+		return
+	}
+
+	err = dbContext.WithTransaction(ctx, func(ctx context.Context) error {
+		prodRep := NewProductsRepository(ctx, dbContext)
+		// The transaction callback may be retried, so results start over on every attempt.
+		response.Results = make([]models.BatchOperationResult, 0, len(request.Operations))
+		for i, operation := range request.Operations {
+			result, err := executeBatchOperation(prodRep, i, operation)
+			if err != nil {
+				return err
+			}
+			response.Results = append(response.Results, result)
+			if result.Status >= http.StatusBadRequest {
+				return errBatchOperationFailed
+			}
+		}
+		return nil
+	})
+
+	if err == errBatchOperationFailed {
+		rollBackResults(&response, request.Operations)
+		return response, nil
+	}
+
+	response.Committed = err == nil
+	return
+}
+
+// rollBackResults marks operations that ran before the failing one as rolled back
+// and those after it as not attempted.
+func rollBackResults(response *models.BatchResponse, operations []models.BatchOperation) {
+	failed := len(response.Results) - 1
+	for i := range response.Results[:failed] {
+		response.Results[i].Status = http.StatusFailedDependency
+		response.Results[i].Error = "rolled back"
+		response.Results[i].Product = nil
+	}
+	for i := failed + 1; i < len(operations); i++ {
+		response.Results = append(response.Results, models.BatchOperationResult{
+			Index:  i,
+			Op:     operations[i].Op,
+			Id:     operations[i].Id,
+			Status: http.StatusFailedDependency,
+			Error:  "not attempted",
+		})
+	}
+}
+
+// executeBatchOperation returns an error only for infrastructure failures;
+// problems with the operation itself are reported in the result.
+func executeBatchOperation(prodRep ProductsRepository, index int, operation models.BatchOperation) (result models.BatchOperationResult, err error) {
+	result = models.BatchOperationResult{Index: index, Op: operation.Op, Id: operation.Id}
+
+	var product *models.Product
+	switch operation.Op {
+	case models.BatchOpCreate:
+		request := models.CreateProductRequest{
+			Name:        operation.Name,
+			Description: operation.Description,
+		}
+		if operation.Unit != nil {
+			request.Unit = *operation.Unit
+		}
+		product, err = prodRep.Insert(request)
+		result.Status = http.StatusCreated
+	case models.BatchOpUpdate:
+		var id primitive.ObjectID
+		id, err = primitive.ObjectIDFromHex(operation.Id)
+		if err != nil {
+			err = ErrProductNotFound
+		} else {
+			product, err = prodRep.Update(models.UpdateProductRequest{
+				Id:          id,
+				Name:        operation.Name,
+				Description: operation.Description,
+				Unit:        operation.Unit,
+			}, *operation.Version)
+		}
+		result.Status = http.StatusOK
+	case models.BatchOpDelete:
+		err = prodRep.SoftDeleteById(operation.Id)
+		result.Status = http.StatusOK
+	}
+
+	if status, ok := batchErrorStatus(err); ok {
+		result.Status = status
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	if err != nil {
+		return
+	}
+
+	if product != nil {
+		result.Id = product.Id.Hex()
+		result.Product = product
+	}
+
+	return
+}
+
+func batchErrorStatus(err error) (int, bool) {
+	switch err {
+	case ErrProductNotFound:
+		return http.StatusNotFound, true
+	case ErrProductDeleted:
+		return http.StatusGone, true
+	case ErrVersionMismatch:
+		return http.StatusPreconditionFailed, true
+	case ErrUniqueKeyConflict:
+		return http.StatusConflict, true
+	default:
+		return 0, false
+	}
+}
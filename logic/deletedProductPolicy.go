@@ -0,0 +1,27 @@
+package logic
+
+import (
+	"fmt"
+	"os"
+)
+
+// DeletedProductPolicy decides what event-driven writes do when they hit a soft-deleted product.
+type DeletedProductPolicy string
+
+const (
+	DeletedProductSkip       DeletedProductPolicy = "skip"
+	DeletedProductRevive     DeletedProductPolicy = "revive"
+	DeletedProductDeadLetter DeletedProductPolicy = "dead-letter"
+)
+
+// DeletedProductPolicyFromEnv reads DELETED_PRODUCT_EVENT_POLICY, defaulting to skip.
+func DeletedProductPolicyFromEnv() (DeletedProductPolicy, error) {
+	switch policy := DeletedProductPolicy(os.Getenv("DELETED_PRODUCT_EVENT_POLICY")); policy {
+	case "":
+		return DeletedProductSkip, nil
+	case DeletedProductSkip, DeletedProductRevive, DeletedProductDeadLetter:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown DELETED_PRODUCT_EVENT_POLICY %q", policy)
+	}
+}
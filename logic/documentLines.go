@@ -0,0 +1,157 @@
+package logic
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"msrd-products/auth"
+	"msrd-products/db"
+	"msrd-products/models"
+	"os"
+	"strings"
+	"time"
+)
+
+type DocumentLinesRepository interface {
+	UpsertByEvent(line models.DocumentLine) (*models.DocumentLine, error)
+	DeleteByEvent(id string) error
+	FindByDocument(documentId string) ([]models.DocumentLine, error)
+	PendingQuantities(productIds []primitive.ObjectID) (map[primitive.ObjectID]models.PendingQuantities, error)
+}
+
+type documentLinesRepository struct {
+	collection *mongo.Collection
+	documents  *mongo.Collection
+	context    context.Context
+}
+
+func NewDocumentLinesRepository(context context.Context, dbContext db.DbContext) DocumentLinesRepository {
+	return &documentLinesRepository{dbContext.GetDocumentLinesCollection(), dbContext.GetDocumentsCollection(), context}
+}
+
+func (r documentLinesRepository) UpsertByEvent(line models.DocumentLine) (newLine *models.DocumentLine, err error) {
+	line.UpdatedAt = time.Now()
+	if tenant, ok := auth.TenantFromContext(r.context); ok {
+		line.TenantId = tenant
+	}
+
+	_, err = r.collection.ReplaceOne(r.context, scopeToTenant(r.context, bson.M{"_id": line.Id}), line, options.Replace().SetUpsert(true))
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return &line, nil
+}
+
+func (r documentLinesRepository) DeleteByEvent(id string) (err error) {
+	_, err = r.collection.DeleteOne(r.context, scopeToTenant(r.context, bson.M{"_id": id}))
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	return
+}
+
+func (r documentLinesRepository) FindByDocument(documentId string) (lines []models.DocumentLine, err error) {
+	oid, _ := primitive.ObjectIDFromHex(documentId)
+
+	curs, err := r.collection.Find(r.context, scopeToTenant(r.context, bson.M{"document_id": oid}), options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	lines = []models.DocumentLine{}
+	err = curs.All(r.context, &lines)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return
+}
+
+// PendingQuantities sums the incoming and outgoing lines of the given products over documents
+// whose status is not final. Lines of documents not received yet count as pending.
+func (r documentLinesRepository) PendingQuantities(productIds []primitive.ObjectID) (pending map[primitive.ObjectID]models.PendingQuantities, err error) {
+	directionSum := func(direction string) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$direction", direction}}, "$quantity", 0}}}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: scopeToTenant(r.context, bson.M{"product_id": bson.M{"$in": productIds}})}},
+		{{Key: "$lookup", Value: bson.M{"from": r.documents.Name(), "localField": "document_id", "foreignField": "_id", "as": "document"}}},
+		{{Key: "$match", Value: bson.M{"document.status": bson.M{"$nin": DocumentFinalStatuses()}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$product_id", "incoming": directionSum(models.DocumentLineIn), "outgoing": directionSum(models.DocumentLineOut)}}},
+	}
+
+	curs, err := r.collection.Aggregate(r.context, pipeline)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	var results []models.PendingQuantities
+	err = curs.All(r.context, &results)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	pending = map[primitive.ObjectID]models.PendingQuantities{}
+	for _, result := range results {
+		pending[result.ProductId] = result
+	}
+
+	return
+}
+
+// DocumentFinalStatuses reads DOCUMENT_FINAL_STATUSES, the statuses after which document lines
+// no longer count as pending, defaulting to completed and cancelled.
+func DocumentFinalStatuses() (statuses []string) {
+	value := os.Getenv("DOCUMENT_FINAL_STATUSES")
+	if value == "" {
+		value = "completed,cancelled"
+	}
+
+	for _, status := range strings.Split(value, ",") {
+		if strings.TrimSpace(status) != "" {
+			statuses = append(statuses, strings.TrimSpace(status))
+		}
+	}
+	return
+}
+
+// AttachPendingQuantities sets the pending quantities of the given products, rounded to the scale of their unit.
+func AttachPendingQuantities(ctx context.Context, dbContext db.DbContext, products []*models.Product) error {
+	var ids []primitive.ObjectID
+	for _, product := range products {
+		ids = append(ids, product.Id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	pending, err := NewDocumentLinesRepository(ctx, dbContext).PendingQuantities(ids)
+	if err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		quantities, ok := pending[product.Id]
+		if !ok {
+			continue
+		}
+		incoming := RoundQuantity(quantities.Incoming, product.Unit)
+		outgoing := RoundQuantity(quantities.Outgoing, product.Unit)
+		product.PendingIncoming = &incoming
+		product.PendingOutgoing = &outgoing
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package logic
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"msrd-products/db"
+	"msrd-products/models"
+	"time"
+)
+
+// ApplyDocumentStatusEvent moves a document to the status of an event. A missing document is created
+// as a stub under the upsert policy and reported with ErrDocumentNotFound otherwise. The event creating
+// a stubbed document completes the stub; its status only applies if the stub has not taken one yet,
+// since the events the stub was created for happened after it.
+// Illegal transitions are recorded and reported with ErrIllegalTransition. Applied changes are queued
+// for delivery to webhook subscribers.
+func ApplyDocumentStatusEvent(ctx context.Context, dbContext db.DbContext, event models.DocumentStatusEvent, source *models.EventSource, transitions DocumentStatusTransitions, policy MissingDocumentPolicy) (*models.Document, error) {
+	id, err := primitive.ObjectIDFromHex(event.DocumentId)
+	if err != nil {
+		return nil, ErrInvalidDocumentId
+	}
+
+	docRep := NewDocumentsRepository(ctx, dbContext)
+	document, err := docRep.FindById(event.DocumentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if document == nil {
+		if policy != MissingDocumentUpsert {
+			return nil, ErrDocumentNotFound
+		}
+
+		document, err = docRep.CreateStub(id)
+		if err != nil {
+			return nil, err
+		}
+	} else if document.Stub && event.Created {
+		if document.Status != "" {
+			return docRep.CompleteStub(id, event.TenantId, &models.DocumentStatusChange{
+				From:      document.Status,
+				To:        event.Status,
+				Timestamp: time.Now(),
+				Source:    source,
+			})
+		}
+
+		document, err = docRep.CompleteStub(id, event.TenantId, nil)
+		if err != nil || document == nil {
+			return document, err
+		}
+	}
+
+	document, err = docRep.UpdateByEvent(models.UpdateDocumentEvent{
+		Id:     document.Id,
+		Status: event.Status,
+		Source: source,
+	}, transitions)
+	if err != nil {
+		return document, err
+	}
+
+	// Looking the change up by its source also covers redelivered messages whose
+	// status was applied before queuing the webhooks failed.
+	if change := appliedChange(document, source); change != nil {
+		err = EnqueueStatusWebhooks(ctx, dbContext, document, *change)
+	}
+
+	return document, err
+}
+
+// appliedChange returns the legal status change recorded for the source, if it is the current status.
+func appliedChange(document *models.Document, source *models.EventSource) *models.DocumentStatusChange {
+	if document == nil || source == nil {
+		return nil
+	}
+	for i := len(document.StatusHistory) - 1; i >= 0; i-- {
+		change := document.StatusHistory[i]
+		if change.Source != nil && *change.Source == *source {
+			if change.Illegal || change.Superseded || change.To != document.Status {
+				return nil
+			}
+			return &change
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"msrd-products/models"
+)
+
+func TestCreateEventCompletesStub(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	source := &models.EventSource{Topic: "MsrdStocks.public.document_statuses", Partition: 0, Offset: 7}
+	event := func(id primitive.ObjectID) models.DocumentStatusEvent {
+		return models.DocumentStatusEvent{DocumentId: id.Hex(), Status: "draft", TenantId: "tenant", Created: true}
+	}
+
+	mt.Run("stub without a status takes the created status", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		stub := bson.D{{Key: "_id", Value: id}, {Key: "status", Value: ""}, {Key: "stub", Value: true}}
+		completed := bson.D{{Key: "_id", Value: id}, {Key: "status", Value: ""}, {Key: "tenant_id", Value: "tenant"}}
+		updated := bson.D{
+			{Key: "_id", Value: id},
+			{Key: "status", Value: "draft"},
+			{Key: "tenant_id", Value: "tenant"},
+			{Key: "status_history", Value: bson.A{bson.D{{Key: "from", Value: ""}, {Key: "to", Value: "draft"}, {Key: "timestamp", Value: time.Now()}, {Key: "source", Value: source}}}},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.documents", mtest.FirstBatch, stub),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: completed}},
+			mtest.CreateCursorResponse(0, "db.documents", mtest.FirstBatch, completed),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: updated}},
+			mtest.CreateCursorResponse(0, "db.webhook_subscriptions", mtest.FirstBatch),
+		)
+
+		document, err := ApplyDocumentStatusEvent(mt.Context(), mockDbContext{database: mt.DB}, event(id), source, DocumentStatusTransitions{}, MissingDocumentQuarantine)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if document.Stub || document.Status != "draft" {
+			mt.Errorf("got stub=%v status=%q", document.Stub, document.Status)
+		}
+
+		updates := commandsNamed(mt, "findAndModify")
+		if len(updates) != 2 {
+			mt.Fatalf("got %d updates, want 2", len(updates))
+		}
+		completion := updates[0].Lookup("update").Document()
+		if _, err := completion.LookupErr("$unset", "stub"); err != nil {
+			mt.Errorf("stub is not cleared: %s", completion)
+		}
+		if tenant := completion.Lookup("$set", "tenant_id").StringValue(); tenant != "tenant" {
+			mt.Errorf("tenant_id: got %q", tenant)
+		}
+		if status := updates[1].Lookup("update").Document().Lookup("$set", "status").StringValue(); status != "draft" {
+			mt.Errorf("status: got %q", status)
+		}
+	})
+
+	mt.Run("stub with a later status keeps it", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		stub := bson.D{{Key: "_id", Value: id}, {Key: "status", Value: "approved"}, {Key: "stub", Value: true}}
+		completed := bson.D{{Key: "_id", Value: id}, {Key: "status", Value: "approved"}, {Key: "tenant_id", Value: "tenant"}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.documents", mtest.FirstBatch, stub),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: completed}},
+		)
+
+		document, err := ApplyDocumentStatusEvent(mt.Context(), mockDbContext{database: mt.DB}, event(id), source, DocumentStatusTransitions{}, MissingDocumentQuarantine)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		if document.Stub || document.Status != "approved" {
+			mt.Errorf("got stub=%v status=%q", document.Stub, document.Status)
+		}
+
+		updates := commandsNamed(mt, "findAndModify")
+		if len(updates) != 1 {
+			mt.Fatalf("got %d updates, want 1", len(updates))
+		}
+		completion := updates[0].Lookup("update").Document()
+		if _, err := completion.LookupErr("$unset", "stub"); err != nil {
+			mt.Errorf("stub is not cleared: %s", completion)
+		}
+		if _, err := completion.LookupErr("$set", "status"); err == nil {
+			mt.Errorf("the created status overwrote the later one: %s", completion)
+		}
+		if superseded := completion.Lookup("$push", "status_history", "superseded"); !superseded.Boolean() {
+			mt.Errorf("the created status is not recorded as superseded: %s", completion)
+		}
+	})
+}
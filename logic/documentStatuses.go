@@ -0,0 +1,51 @@
+package logic
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DocumentStatusTransitions maps a status to the statuses a document may move to from it.
+// The key "*" lists statuses reachable from any status. Without any entries every transition is allowed.
+type DocumentStatusTransitions map[string][]string
+
+// DocumentStatusTransitionsFromEnv reads DOCUMENT_STATUS_TRANSITIONS such as
+// "draft=pending,cancelled;pending=approved,rejected;*=cancelled".
+func DocumentStatusTransitionsFromEnv() (DocumentStatusTransitions, error) {
+	transitions := DocumentStatusTransitions{}
+
+	for _, entry := range strings.Split(os.Getenv("DOCUMENT_STATUS_TRANSITIONS"), ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		from, targets, found := strings.Cut(entry, "=")
+		if !found || strings.TrimSpace(from) == "" {
+			return nil, fmt.Errorf("invalid DOCUMENT_STATUS_TRANSITIONS entry %q", entry)
+		}
+
+		from = strings.TrimSpace(from)
+		for _, to := range strings.Split(targets, ",") {
+			if strings.TrimSpace(to) != "" {
+				transitions[from] = append(transitions[from], strings.TrimSpace(to))
+			}
+		}
+	}
+
+	return transitions, nil
+}
+
+// Allows reports whether a document may move from one status to another.
+// Documents without a status yet may take any status.
+func (transitions DocumentStatusTransitions) Allows(from string, to string) bool {
+	if len(transitions) == 0 || from == "" || from == to {
+		return true
+	}
+
+	for _, target := range append(transitions[from], transitions["*"]...) {
+		if target == to {
+			return true
+		}
+	}
+	return false
+}
@@ -5,14 +5,21 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
 	"msrd-products/db"
 	"msrd-products/models"
+	"time"
 )
 
 type DocumentsRepository interface {
-	UpdateByEvent(document models.UpdateDocumentEvent) (*models.Document, error)
+	UpdateByEvent(document models.UpdateDocumentEvent, transitions DocumentStatusTransitions) (*models.Document, error)
 	FindById(id string) (*models.Document, error)
+	StatusHistory(id string) ([]models.DocumentStatusChange, error)
+	CreateStub(id primitive.ObjectID) (*models.Document, error)
+	CompleteStub(id primitive.ObjectID, tenant string, superseded *models.DocumentStatusChange) (*models.Document, error)
+	QueryDocuments(request models.DocumentQueryRequest) (error, models.QueryResponse[models.Document])
+	StatusSummary(filter models.DocumentFilter) ([]models.DocumentStatusCount, error)
 }
 
 type documentsRepository struct {
@@ -24,16 +31,63 @@ func NewDocumentsRepository(context context.Context, dbContext db.DbContext) Doc
 	return &documentsRepository{dbContext.GetDocumentsCollection(), context}
 }
 
-func (r documentsRepository) UpdateByEvent(document models.UpdateDocumentEvent) (newDocument *models.Document, err error) {
+// UpdateByEvent moves the document to the status of the event and records the change with its source.
+// An illegal transition is recorded as such and reported with ErrIllegalTransition, leaving the status as is.
+// Events whose source is already recorded are ignored, so redelivered messages change nothing.
+func (r documentsRepository) UpdateByEvent(document models.UpdateDocumentEvent, transitions DocumentStatusTransitions) (newDocument *models.Document, err error) {
+	current, err := r.FindById(document.Id.Hex())
+	if err != nil || current == nil {
+		return current, err
+	}
+
+	if current.Status == document.Status || recordedSource(current.StatusHistory, document.Source) {
+		return current, nil
+	}
 
-	_, err = r.collection.UpdateOne(r.context, bson.M{"_id": document.Id}, bson.M{"$set": bson.M{"status": document.Status}})
+	now := time.Now()
+	change := models.DocumentStatusChange{
+		From:      current.Status,
+		To:        document.Status,
+		Timestamp: now,
+		Source:    document.Source,
+		Illegal:   !transitions.Allows(current.Status, document.Status),
+	}
+
+	update := bson.M{
+		"$set":  bson.M{"status": document.Status, "updated_at": now},
+		"$push": bson.M{"status_history": change},
+	}
+	if change.Illegal {
+		update = bson.M{"$push": bson.M{"status_history": change}}
+	}
+
+	// Matching the status read above keeps concurrent events from skipping the transition check.
+	filter := scopeToTenant(r.context, bson.M{"_id": document.Id, "status": current.Status})
+	err = r.collection.FindOneAndUpdate(r.context, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&newDocument)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrStatusChanged
+	}
 
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	err = r.collection.FindOne(r.context, bson.M{"_id": document.Id}).Decode(&newDocument)
+	if change.Illegal {
+		return newDocument, ErrIllegalTransition
+	}
+
+	return
+}
+
+// CreateStub creates an empty document marked as a stub unless the document exists already.
+// The status is left empty so that the first event may set any status.
+func (r documentsRepository) CreateStub(id primitive.ObjectID) (document *models.Document, err error) {
+	filter := scopeToTenant(r.context, bson.M{"_id": id})
+	update := bson.M{"$setOnInsert": bson.M{"status": "", "stub": true, "created_at": time.Now()}}
+
+	err = r.collection.FindOneAndUpdate(r.context, filter, update, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&document)
 
 	if err != nil {
 		log.Println(err)
@@ -43,20 +97,159 @@ func (r documentsRepository) UpdateByEvent(document models.UpdateDocumentEvent)
 	return
 }
 
+// CompleteStub turns a stub into a regular document once the event creating the document arrives,
+// filling in its tenant when the stub was created without one. A superseded change is recorded with it,
+// so a redelivered creation event is recognized. Documents that are not stubs are returned unchanged.
+func (r documentsRepository) CompleteStub(id primitive.ObjectID, tenant string, superseded *models.DocumentStatusChange) (document *models.Document, err error) {
+	set := bson.M{"updated_at": time.Now()}
+	if tenant != "" {
+		set["tenant_id"] = tenant
+	}
+
+	filter := scopeToTenant(r.context, bson.M{"_id": id, "stub": true})
+	update := bson.M{"$set": set, "$unset": bson.M{"stub": ""}}
+	if superseded != nil {
+		superseded.Superseded = true
+		update["$push"] = bson.M{"status_history": superseded}
+	}
+
+	err = r.collection.FindOneAndUpdate(r.context, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&document)
+
+	if err == mongo.ErrNoDocuments {
+		return r.FindById(id.Hex())
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return
+}
+
+// StatusHistory returns the recorded status changes of a document, oldest first, or nil if there is no such document.
+func (r documentsRepository) StatusHistory(id string) (history []models.DocumentStatusChange, err error) {
+	document, err := r.FindById(id)
+	if err != nil || document == nil {
+		return
+	}
+
+	history = document.StatusHistory
+	if history == nil {
+		history = []models.DocumentStatusChange{}
+	}
+	return
+}
+
+func recordedSource(history []models.DocumentStatusChange, source *models.EventSource) bool {
+	if source == nil {
+		return false
+	}
+	for _, change := range history {
+		if change.Source != nil && *change.Source == *source {
+			return true
+		}
+	}
+	return false
+}
+
 func (r documentsRepository) FindById(id string) (document *models.Document, err error) {
 	oid, _ := primitive.ObjectIDFromHex(id)
 
+	err = r.collection.FindOne(r.context, scopeToTenant(r.context, bson.M{"_id": oid})).Decode(&document)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	err = r.collection.FindOne(r.context, bson.M{"_id": oid}).Decode(&document)
+	return document, nil
+}
 
+func (r documentsRepository) QueryDocuments(request models.DocumentQueryRequest) (err error, response models.QueryResponse[models.Document]) {
+	filter := scopeToTenant(r.context, documentFilter(request.DocumentFilter))
+
+	var opts options.FindOptions
+	opts.
+		SetSkip(request.Offset).
+		SetLimit(request.Rows).
+		SetProjection(bson.M{"status_history": 0})
+	if request.SortField != "" && request.SortOrder != 0 {
+		opts.SetSort(bson.D{{Key: request.SortField, Value: request.SortOrder}})
+	}
+
+	curs, err := r.collection.Find(r.context, filter, &opts)
 	if err != nil {
 		log.Println(err)
 		return
 	}
+	defer curs.Close(r.context)
 
-	return document, nil
+	response.Result = []models.Document{}
+	for curs.Next(r.context) {
+		var document models.Document
+		err = curs.Decode(&document)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		response.Result = append(response.Result, document)
+	}
+
+	totalRecCount, err := r.collection.CountDocuments(r.context, filter)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	paginate(request.QueryRequest, totalRecCount, &response)
+
+	return
+}
+
+// StatusSummary counts the matching documents per status, most frequent status first.
+func (r documentsRepository) StatusSummary(filter models.DocumentFilter) (summary []models.DocumentStatusCount, err error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: scopeToTenant(r.context, documentFilter(filter))}},
+		{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+
+	curs, err := r.collection.Aggregate(r.context, pipeline)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	summary = []models.DocumentStatusCount{}
+	err = curs.All(r.context, &summary)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return
+}
+
+func documentFilter(filter models.DocumentFilter) bson.M {
+	query := bson.M{}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	updatedAt := bson.M{}
+	if filter.UpdatedFrom != nil {
+		updatedAt["$gte"] = *filter.UpdatedFrom
+	}
+	if filter.UpdatedTo != nil {
+		updatedAt["$lt"] = *filter.UpdatedTo
+	}
+	if len(updatedAt) > 0 {
+		query["updated_at"] = updatedAt
+	}
+
+	return query
 }
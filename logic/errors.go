@@ -0,0 +1,23 @@
+package logic
+
+import "errors"
+
+var (
+	ErrProductNotFound      = errors.New("product not found")
+	ErrProductDeleted       = errors.New("product is deleted")
+	ErrVersionMismatch      = errors.New("product has been modified since the given version")
+	ErrUniqueKeyConflict    = errors.New("another product already uses the same unique key")
+	ErrAsOfQueryTooBroad    = errors.New("too many products to reconstruct for an as-of query")
+	ErrApiKeyNotFound       = errors.New("api key not found")
+	ErrApiKeyInvalid        = errors.New("api key is invalid, expired or revoked")
+	ErrApiKeyRotated        = errors.New("api key has already been rotated")
+	ErrApiKeyRevoked        = errors.New("api key has already been revoked")
+	ErrIllegalTransition    = errors.New("document status transition is not allowed")
+	ErrStatusChanged        = errors.New("document status has changed concurrently")
+	ErrDocumentNotFound     = errors.New("document not found")
+	ErrInvalidDocumentId    = errors.New("document id is invalid")
+	ErrEventNotFound        = errors.New("quarantined event not found")
+	ErrEventReplayed        = errors.New("quarantined event has already been replayed")
+	ErrWebhookNotFound      = errors.New("webhook not found")
+	ErrWebhookUrlNotAllowed = errors.New("webhook url must be http or https and point to a public host")
+)
@@ -0,0 +1,301 @@
+package logic
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"msrd-products/auth"
+	"msrd-products/db"
+	"msrd-products/models"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// historyIgnoredFields change on every write and are kept on the entry itself rather than in its changes.
+var historyIgnoredFields = map[string]bool{"_id": true, "version": true, "updated_at": true}
+
+type ProductHistoryRepository interface {
+	Append(productId primitive.ObjectID, operation string, before bson.M, after bson.M) error
+	QueryHistory(productId primitive.ObjectID, request models.HistoryQueryRequest) (error, models.QueryResponse[models.ProductHistoryEntry])
+	ChangesSince(productIds []primitive.ObjectID, since time.Time) (map[primitive.ObjectID][]models.ProductHistoryEntry, error)
+	LastChangedAt(productIds []primitive.ObjectID, asOf time.Time) (map[primitive.ObjectID]time.Time, error)
+	LatestChangeAt(asOf time.Time) (time.Time, error)
+}
+
+type productHistoryRepository struct {
+	collection *mongo.Collection
+	context    context.Context
+}
+
+func NewProductHistoryRepository(context context.Context, dbContext db.DbContext) ProductHistoryRepository {
+	return &productHistoryRepository{dbContext.GetProductHistoryCollection(), context}
+}
+
+// Append records the write that turned before into after, attributed to the actor of the context.
+// A nil before stands for a product that did not exist yet.
+func (r productHistoryRepository) Append(productId primitive.ObjectID, operation string, before bson.M, after bson.M) (err error) {
+	entry := models.ProductHistoryEntry{
+		ProductId: productId,
+		Version:   documentVersion(after),
+		Operation: operation,
+		Changes:   diffDocuments(before, after),
+	}
+
+	if updatedAt, ok := after["updated_at"].(primitive.DateTime); ok {
+		entry.Timestamp = updatedAt.Time()
+	} else {
+		entry.Timestamp = time.Now()
+	}
+
+	if actor, ok := auth.ActorFromContext(r.context); ok {
+		entry.Actor = actor
+	}
+
+	_, err = r.collection.InsertOne(r.context, entry)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return
+}
+
+// QueryHistory pages through the history of a product, newest first,
+// optionally narrowed to entries changing one field or made by one actor.
+func (r productHistoryRepository) QueryHistory(productId primitive.ObjectID, request models.HistoryQueryRequest) (err error, response models.QueryResponse[models.ProductHistoryEntry]) {
+	filter := bson.M{"product_id": productId}
+	if request.Field != "" {
+		filter["changes.field"] = request.Field
+	}
+	if request.Actor != "" {
+		filter["actor.id"] = request.Actor
+	}
+
+	var opts options.FindOptions
+	opts.
+		SetSkip(request.Offset).
+		SetLimit(request.Rows).
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+	if request.SortField != "" && request.SortOrder != 0 {
+		opts.SetSort(bson.D{{Key: request.SortField, Value: request.SortOrder}})
+	}
+
+	curs, err := r.collection.Find(r.context, filter, &opts)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	response.Result = []models.ProductHistoryEntry{}
+	for curs.Next(r.context) {
+		var entry models.ProductHistoryEntry
+		err = curs.Decode(&entry)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		response.Result = append(response.Result, entry)
+	}
+
+	totalRecCount, err := r.collection.CountDocuments(r.context, filter)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	paginate(request.QueryRequest, totalRecCount, &response)
+
+	return
+}
+
+// ChangesSince returns the entries written after since for each of the products, newest first.
+func (r productHistoryRepository) ChangesSince(productIds []primitive.ObjectID, since time.Time) (changes map[primitive.ObjectID][]models.ProductHistoryEntry, err error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}})
+
+	curs, err := r.collection.Find(r.context, bson.M{"product_id": bson.M{"$in": productIds}, "timestamp": bson.M{"$gt": since}}, opts)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer curs.Close(r.context)
+
+	changes = map[primitive.ObjectID][]models.ProductHistoryEntry{}
+	for curs.Next(r.context) {
+		var entry models.ProductHistoryEntry
+		err = curs.Decode(&entry)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		changes[entry.ProductId] = append(changes[entry.ProductId], entry)
+	}
+
+	return changes, curs.Err()
+}
+
+// LastChangedAt returns, for each product that has one, the time of its latest entry at or before asOf.
+func (r productHistoryRepository) LastChangedAt(productIds []primitive.ObjectID, asOf time.Time) (changedAt map[primitive.ObjectID]time.Time, err error) {
+	curs, err := r.collection.Aggregate(r.context, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"product_id": bson.M{"$in": productIds}, "timestamp": bson.M{"$lte": asOf}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$product_id", "timestamp": bson.M{"$max": "$timestamp"}}}},
+	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer curs.Close(r.context)
+
+	changedAt = map[primitive.ObjectID]time.Time{}
+	for curs.Next(r.context) {
+		var last struct {
+			ProductId primitive.ObjectID `bson:"_id"`
+			Timestamp time.Time          `bson:"timestamp"`
+		}
+		err = curs.Decode(&last)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		changedAt[last.ProductId] = last.Timestamp
+	}
+
+	return changedAt, curs.Err()
+}
+
+// LatestChangeAt returns the time of the latest entry of any product at or before asOf, or the zero time
+// when there is none. Deletions are recorded too, so it also moves when a product leaves a result.
+func (r productHistoryRepository) LatestChangeAt(asOf time.Time) (latest time.Time, err error) {
+	var entry models.ProductHistoryEntry
+	err = r.collection.FindOne(r.context, bson.M{"timestamp": bson.M{"$lte": asOf}},
+		options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetProjection(bson.M{"timestamp": 1}),
+	).Decode(&entry)
+
+	if err == mongo.ErrNoDocuments {
+		return time.Time{}, nil
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return entry.Timestamp, nil
+}
+
+// diffDocuments lists the top-level fields whose values differ between two product documents.
+func diffDocuments(before bson.M, after bson.M) (changes []models.FieldChange) {
+	fields := map[string]bool{}
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		if !historyIgnoredFields[field] {
+			names = append(names, field)
+		}
+	}
+	sort.Strings(names)
+
+	changes = []models.FieldChange{}
+	for _, field := range names {
+		beforeValue, beforeExists := before[field]
+		afterValue, afterExists := after[field]
+		if beforeExists != afterExists || !reflect.DeepEqual(beforeValue, afterValue) {
+			changes = append(changes, models.FieldChange{
+				Field:        field,
+				Before:       beforeValue,
+				BeforeExists: beforeExists,
+				After:        afterValue,
+				AfterExists:  afterExists,
+			})
+		}
+	}
+	return
+}
+
+// applyUpdate computes the document a $set/$unset/$inc update turns before into,
+// so a write and its history entry can come from a single FindOneAndUpdate.
+func applyUpdate(before bson.M, update bson.M) (after bson.M, err error) {
+	after = bson.M{}
+	for field, value := range before {
+		after[field] = value
+	}
+
+	if set, ok := update["$set"]; ok {
+		var fields bson.M
+		fields, err = toDocument(set)
+		if err != nil {
+			return
+		}
+		for field, value := range fields {
+			after[field] = value
+		}
+	}
+
+	if unset, ok := update["$unset"].(bson.M); ok {
+		for field := range unset {
+			delete(after, field)
+		}
+	}
+
+	if inc, ok := update["$inc"].(bson.M); ok {
+		for field, value := range inc {
+			after[field] = numberValue(after[field]) + numberValue(value)
+		}
+	}
+
+	return
+}
+
+// toDocument round-trips a value through BSON so it compares equal to what is read back from the database.
+func toDocument(value interface{}) (document bson.M, err error) {
+	data, err := bson.Marshal(value)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	err = bson.Unmarshal(data, &document)
+	if err != nil {
+		log.Println(err)
+	}
+	return
+}
+
+func documentVersion(document bson.M) int64 {
+	return numberValue(document["version"])
+}
+
+func numberValue(value interface{}) int64 {
+	switch number := value.(type) {
+	case int32:
+		return int64(number)
+	case int64:
+		return number
+	case int:
+		return int64(number)
+	case float64:
+		return int64(number)
+	default:
+		return 0
+	}
+}
+
+func decodeProduct(document bson.M) (product *models.Product, err error) {
+	data, err := bson.Marshal(document)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	err = bson.Unmarshal(data, &product)
+	if err != nil {
+		log.Println(err)
+	}
+	return
+}
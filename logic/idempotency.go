@@ -0,0 +1,95 @@
+package logic
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"msrd-products/db"
+	"msrd-products/models"
+	"time"
+)
+
+type IdempotencyRepository interface {
+	Begin(record models.IdempotencyRecord, lockTimeout time.Duration) (*models.IdempotencyRecord, bool, error)
+	Complete(id models.IdempotencyKeyId, status int, body []byte, header map[string]string) error
+	Release(id models.IdempotencyKeyId) error
+}
+
+type idempotencyRepository struct {
+	collection *mongo.Collection
+	context    context.Context
+}
+
+func NewIdempotencyRepository(context context.Context, dbContext db.DbContext) IdempotencyRepository {
+	return &idempotencyRepository{dbContext.GetIdempotencyKeysCollection(), context}
+}
+
+// Begin claims an idempotency key for a new request. When the key is already known it returns
+// the stored record and false, unless it is a pending claim older than lockTimeout, which is taken over.
+func (r idempotencyRepository) Begin(record models.IdempotencyRecord, lockTimeout time.Duration) (existing *models.IdempotencyRecord, claimed bool, err error) {
+	record.Status = models.IdempotencyPending
+	record.CreatedAt = time.Now()
+
+	_, err = r.collection.InsertOne(r.context, record)
+	if err == nil {
+		return nil, true, nil
+	}
+
+	if !mongo.IsDuplicateKeyError(err) {
+		log.Println(err)
+		return
+	}
+
+	err = r.collection.FindOneAndUpdate(r.context,
+		bson.M{"_id": record.Id, "status": models.IdempotencyPending, "created_at": bson.M{"$lt": record.CreatedAt.Add(-lockTimeout)}},
+		bson.M{"$set": record},
+	).Err()
+	if err == nil {
+		return nil, true, nil
+	}
+
+	if err != mongo.ErrNoDocuments {
+		log.Println(err)
+		return
+	}
+
+	err = r.collection.FindOne(r.context, bson.M{"_id": record.Id}).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		// The record expired between the insert and the lookup, so claim it again.
+		return r.Begin(record, lockTimeout)
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return existing, false, nil
+}
+
+func (r idempotencyRepository) Complete(id models.IdempotencyKeyId, status int, body []byte, header map[string]string) (err error) {
+	_, err = r.collection.UpdateOne(r.context, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"status":          models.IdempotencyCompleted,
+		"response_status": status,
+		"response_body":   body,
+		"response_header": header,
+	}})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	return
+}
+
+// Release drops a pending claim so the request can be retried with the same key.
+func (r idempotencyRepository) Release(id models.IdempotencyKeyId) (err error) {
+	_, err = r.collection.DeleteOne(r.context, bson.M{"_id": id, "status": models.IdempotencyPending})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	return
+}
@@ -0,0 +1,26 @@
+package logic
+
+import (
+	"fmt"
+	"os"
+)
+
+// MissingDocumentPolicy decides what status events do when their document does not exist.
+type MissingDocumentPolicy string
+
+const (
+	MissingDocumentQuarantine MissingDocumentPolicy = "quarantine"
+	MissingDocumentUpsert     MissingDocumentPolicy = "upsert"
+)
+
+// MissingDocumentPolicyFromEnv reads MISSING_DOCUMENT_EVENT_POLICY, defaulting to quarantine.
+func MissingDocumentPolicyFromEnv() (MissingDocumentPolicy, error) {
+	switch policy := MissingDocumentPolicy(os.Getenv("MISSING_DOCUMENT_EVENT_POLICY")); policy {
+	case "":
+		return MissingDocumentQuarantine, nil
+	case MissingDocumentQuarantine, MissingDocumentUpsert:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown MISSING_DOCUMENT_EVENT_POLICY %q", policy)
+	}
+}
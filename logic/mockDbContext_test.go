@@ -0,0 +1,55 @@
+package logic
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"msrd-products/db"
+)
+
+// mockDbContext serves the collections a test needs from a mocked deployment.
+type mockDbContext struct {
+	db.DbContext
+	database *mongo.Database
+}
+
+// WithTransaction runs fn right away, since the mocked deployment answers commands one by one.
+func (m mockDbContext) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func (m mockDbContext) GetProductsCollection() *mongo.Collection {
+	return m.database.Collection("products")
+}
+
+func (m mockDbContext) GetProductHistoryCollection() *mongo.Collection {
+	return m.database.Collection("product_history")
+}
+
+func (m mockDbContext) GetDocumentsCollection() *mongo.Collection {
+	return m.database.Collection("documents")
+}
+
+func (m mockDbContext) GetDocumentLinesCollection() *mongo.Collection {
+	return m.database.Collection("document_lines")
+}
+
+func (m mockDbContext) GetWebhookSubscriptionsCollection() *mongo.Collection {
+	return m.database.Collection("webhook_subscriptions")
+}
+
+func (m mockDbContext) GetWebhookDeliveriesCollection() *mongo.Collection {
+	return m.database.Collection("webhook_deliveries")
+}
+
+// commandsNamed returns the commands of the given name sent to the mocked deployment, in order.
+func commandsNamed(mt *mtest.T, name string) (commands []bson.Raw) {
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == name {
+			commands = append(commands, event.Command)
+		}
+	}
+	return
+}
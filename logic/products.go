@@ -7,6 +7,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
+	"msrd-products/auth"
 	"msrd-products/db"
 	"msrd-products/models"
 	"time"
@@ -14,149 +15,427 @@ import (
 
 type ProductsRepository interface {
 	Insert(product models.CreateProductRequest) (*models.Product, error)
-	FindById(id string) (*models.Product, error)
-	Update(product models.UpdateProductRequest) (*models.Product, error)
+	FindById(id string, opts ...ReadOption) (*models.Product, error)
+	Update(product models.UpdateProductRequest, version int64) (*models.Product, error)
+	Patch(id primitive.ObjectID, version int64, set bson.M, unset []string) (*models.Product, error)
 	UpdateByEvent(product models.UpdateProductEvent) (*models.Product, error)
 	SoftDeleteById(id string) error
-	SoftBatchDeleteById(ids []string) error
-	QueryProducts(request models.QueryRequest) (error, models.QueryResponse[models.Product])
+	SoftBatchDeleteById(ids []string) (models.BatchDeleteResponse, error)
+	RestoreById(id string) (*models.Product, error)
+	RestoreBatchById(ids []string) (models.BatchRestoreResponse, error)
+	QueryProducts(request models.QueryRequest, opts ...ReadOption) (error, models.QueryResponse[models.Product])
+	QueryTrash(request models.QueryRequest) (error, models.QueryResponse[models.Product])
+	MigrateQuantities() (int64, error)
 }
 
 type productRepository struct {
 	collection *mongo.Collection
+	history    ProductHistoryRepository
 	context    context.Context
+	dbContext  db.DbContext
 }
 
 func NewProductsRepository(context context.Context, dbContext db.DbContext) ProductsRepository {
-	return &productRepository{dbContext.GetProductsCollection(), context}
+	return &productRepository{dbContext.GetProductsCollection(), NewProductHistoryRepository(context, dbContext), context, dbContext}
+}
+
+// atomically runs fn in a transaction with a repository taking part in it, so a product write and its
+// history entry are stored together or not at all. A context already in a transaction, such as that of
+// an atomic batch, is joined instead.
+func (r productRepository) atomically(fn func(r productRepository) error) error {
+	if mongo.SessionFromContext(r.context) != nil {
+		return fn(r)
+	}
+
+	return r.dbContext.WithTransaction(r.context, func(ctx context.Context) error {
+		return fn(productRepository{r.collection, NewProductHistoryRepository(ctx, r.dbContext), ctx, r.dbContext})
+	})
 }
 
 func (r productRepository) Insert(product models.CreateProductRequest) (newProduct *models.Product, err error) {
 	product.CreatedAt = time.Now()
 	product.UpdatedAt = product.CreatedAt
+	product.CreatedBy = r.actor()
+	product.TenantId, _ = auth.TenantFromContext(r.context)
+	product.UpdatedBy = product.CreatedBy
+	product.Version = 1
+
+	err = r.atomically(func(r productRepository) error {
+		res, err := r.collection.InsertOne(r.context, product)
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrUniqueKeyConflict
+		}
+		if err != nil {
+			log.Println(err)
+			return err
+		}
 
-	res, err := r.collection.InsertOne(r.context, product)
-
-	if err != nil {
-		log.Println(err)
-		return
-	}
+		var after bson.M
+		err = r.collection.FindOne(r.context, bson.M{"_id": res.InsertedID}).Decode(&after)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
 
-	query := bson.M{"_id": res.InsertedID}
+		err = r.history.Append(res.InsertedID.(primitive.ObjectID), models.HistoryOpCreate, nil, after)
+		if err != nil {
+			return err
+		}
 
-	err = r.collection.FindOne(r.context, query).Decode(&newProduct)
-
-	if err != nil {
-		log.Println(err)
-		return
-	}
+		newProduct, err = decodeProduct(after)
+		return err
+	})
 
 	return
 }
 
-func (r productRepository) Update(product models.UpdateProductRequest) (newProduct *models.Product, err error) {
+// Update replaces the editable fields of a product if it is still at the given version,
+// returning ErrVersionMismatch when somebody else has written it in the meantime.
+// The unit is kept when the request leaves it out.
+func (r productRepository) Update(product models.UpdateProductRequest, version int64) (*models.Product, error) {
 	product.UpdatedAt = time.Now()
+	product.UpdatedBy = r.actor()
 
-	_, err = r.collection.UpdateOne(r.context, bson.M{"_id": product.Id}, bson.M{"$set": product})
+	return r.updateVersion(product.Id, version, bson.M{"$set": product}, models.HistoryOpUpdate)
+}
 
-	if err != nil {
-		log.Println(err)
-		return
+// Patch sets and unsets only the given fields, under the same version check as Update.
+func (r productRepository) Patch(id primitive.ObjectID, version int64, set bson.M, unset []string) (*models.Product, error) {
+	fields := bson.M{"updated_at": time.Now()}
+	if actor := r.actor(); actor != nil {
+		fields["updated_by"] = actor
+	}
+	for field, value := range set {
+		fields[field] = value
 	}
 
-	err = r.collection.FindOne(r.context, bson.M{"_id": product.Id}).Decode(&newProduct)
+	update := bson.M{"$set": fields}
+	if len(unset) > 0 {
+		unsetFields := bson.M{}
+		for _, field := range unset {
+			unsetFields[field] = ""
+		}
+		update["$unset"] = unsetFields
+	}
 
-	if err != nil {
-		log.Println(err)
-		return
+	return r.updateVersion(id, version, update, models.HistoryOpPatch)
+}
+
+func (r productRepository) updateVersion(id primitive.ObjectID, version int64, update bson.M, operation string) (newProduct *models.Product, err error) {
+	update["$inc"] = bson.M{"version": 1}
+
+	newProduct, err = r.writeWithHistory(bson.M{"_id": id, "deleted": nil, "version": versionFilter(version)}, update, operation)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, r.missingProductError(id)
 	}
 
 	return
 }
 
+// UpdateByEvent applies a change received from another service, attributed to the actor of the context
+// or, when the caller set none, to the system.
 func (r productRepository) UpdateByEvent(product models.UpdateProductEvent) (newProduct *models.Product, err error) {
 	product.UpdatedAt = time.Now()
+	product.UpdatedBy = r.actor()
+	if product.UpdatedBy == nil {
+		systemActor := auth.SystemActor("event")
+		product.UpdatedBy = &systemActor
+	}
 
-	_, err = r.collection.UpdateOne(r.context, bson.M{"_id": product.Id}, bson.M{"$set": product})
+	newProduct, err = r.writeWithHistory(
+		bson.M{"_id": product.Id, "deleted": nil},
+		bson.M{"$set": product, "$inc": bson.M{"version": 1}},
+		models.HistoryOpStockUpdate,
+	)
 
-	if err != nil {
-		log.Println(err)
-		return
+	if err == mongo.ErrNoDocuments {
+		return nil, r.missingProductError(product.Id)
 	}
 
-	err = r.collection.FindOne(r.context, bson.M{"_id": product.Id}).Decode(&newProduct)
+	return
+}
 
-	if err != nil {
-		log.Println(err)
-		return
-	}
+// writeWithHistory applies update to the product matching filter and appends the change to its history,
+// both in one transaction. The written document is derived from the one replaced, so both come from
+// the same atomic write. It returns mongo.ErrNoDocuments when nothing matches.
+func (r productRepository) writeWithHistory(filter bson.M, update bson.M, operation string) (product *models.Product, err error) {
+	err = r.atomically(func(r productRepository) error {
+		var before bson.M
+		err := r.collection.FindOneAndUpdate(r.context, r.scoped(filter), update,
+			options.FindOneAndUpdate().SetReturnDocument(options.Before),
+		).Decode(&before)
+
+		if err == mongo.ErrNoDocuments {
+			return err
+		}
+
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrUniqueKeyConflict
+		}
+
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+
+		after, err := applyUpdate(before, update)
+		if err != nil {
+			return err
+		}
+
+		err = r.history.Append(before["_id"].(primitive.ObjectID), operation, before, after)
+		if err != nil {
+			return err
+		}
+
+		product, err = decodeProduct(after)
+		return err
+	})
 
 	return
 }
 
-func (r productRepository) FindById(id string) (product *models.Product, err error) {
+// FindById returns nil without an error when the product does not exist (or did not exist yet at AsOf),
+// and ErrProductDeleted for soft-deleted products unless IncludeDeleted is set.
+func (r productRepository) FindById(id string, opts ...ReadOption) (product *models.Product, err error) {
+	readOptions := buildReadOptions(opts)
 	oid, _ := primitive.ObjectIDFromHex(id)
 
+	if readOptions.AsOf != nil {
+		product, err = r.findByIdAsOf(oid, *readOptions.AsOf)
+	} else {
+		err = r.collection.FindOne(r.context, r.scoped(bson.M{"_id": oid})).Decode(&product)
+	}
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	err = r.collection.FindOne(r.context, bson.M{"_id": oid}).Decode(&product)
+	if product == nil {
+		return nil, nil
+	}
+
+	if product.Deleted && !readOptions.IncludeDeleted {
+		return nil, ErrProductDeleted
+	}
+
+	return product, nil
+}
+
+// missingProductError explains why a conditional write matched nothing:
+// the product is soft-deleted, never existed, or is at another version.
+func (r productRepository) missingProductError(id primitive.ObjectID) error {
+	var product models.Product
+	err := r.collection.FindOne(r.context, r.scoped(bson.M{"_id": id})).Decode(&product)
+
+	if err == mongo.ErrNoDocuments {
+		return ErrProductNotFound
+	}
 
 	if err != nil {
 		log.Println(err)
-		return
+		return err
 	}
 
-	return product, nil
+	if product.Deleted {
+		return ErrProductDeleted
+	}
+
+	return ErrVersionMismatch
+}
+
+// versionFilter matches the expected version. Products written before versioning count as version 0.
+func versionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
 }
 
+// SoftDeleteById returns ErrProductNotFound for unknown products and ErrProductDeleted for products already deleted.
 func (r productRepository) SoftDeleteById(id string) (err error) {
 	oid, _ := primitive.ObjectIDFromHex(id)
-	_, err = r.collection.UpdateOne(r.context, bson.M{"_id": oid}, bson.M{"$set": bson.M{"updated_at": time.Now(), "deleted": true}})
+	_, err = r.writeWithHistory(
+		bson.M{"_id": oid, "deleted": bson.M{"$ne": true}},
+		bson.M{"$set": r.deletionFields(), "$inc": bson.M{"version": 1}},
+		models.HistoryOpDelete,
+	)
+
+	if err == mongo.ErrNoDocuments {
+		return r.missingProductError(oid)
+	}
+
+	return
+}
+
+// SoftBatchDeleteById deletes the given products and reports which ids were deleted,
+// which had already been deleted and which do not exist.
+func (r productRepository) SoftBatchDeleteById(ids []string) (response models.BatchDeleteResponse, err error) {
+	response.Deleted = []string{}
+	response.AlreadyDeleted = []string{}
+	response.NotFound = []string{}
+
+	for _, id := range ids {
+		err = r.SoftDeleteById(id)
+
+		switch err {
+		case nil:
+			response.Deleted = append(response.Deleted, id)
+		case ErrProductDeleted:
+			response.AlreadyDeleted = append(response.AlreadyDeleted, id)
+		case ErrProductNotFound:
+			response.NotFound = append(response.NotFound, id)
+		default:
+			return
+		}
+	}
+
+	return response, nil
+}
 
+// deletionFields marks a product as deleted, recording when and by whom.
+func (r productRepository) deletionFields() bson.M {
+	now := time.Now()
+	fields := bson.M{"updated_at": now, "deleted": true, "deleted_at": now}
+	if actor := r.actor(); actor != nil {
+		fields["deleted_by"] = actor
+		fields["updated_by"] = actor
+	}
+	return fields
+}
+
+// scoped restricts a filter to the tenant of the repository context.
+func (r productRepository) scoped(filter bson.M) bson.M {
+	return scopeToTenant(r.context, filter)
+}
+
+// actor returns the actor the context carries, or nil when there is none.
+func (r productRepository) actor() *models.Actor {
+	if actor, ok := auth.ActorFromContext(r.context); ok {
+		return &actor
+	}
+	return nil
+}
+
+// RestoreById undoes a soft delete. It returns ErrProductNotFound for unknown products and products that are not deleted.
+// The name is the unique key among live products, so the unique index refuses a restore with ErrUniqueKeyConflict
+// when a product created since the deletion uses the same name.
+func (r productRepository) RestoreById(id string) (product *models.Product, err error) {
+	oid, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		log.Println(err)
-		return
+		return nil, ErrProductNotFound
+	}
+
+	restored := bson.M{"updated_at": time.Now()}
+	if actor := r.actor(); actor != nil {
+		restored["updated_by"] = actor
+	}
+
+	product, err = r.writeWithHistory(bson.M{"_id": oid, "deleted": true}, bson.M{
+		"$set":   restored,
+		"$unset": bson.M{"deleted": "", "deleted_at": "", "deleted_by": ""},
+		"$inc":   bson.M{"version": 1},
+	}, models.HistoryOpRestore)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrProductNotFound
 	}
 
 	return
 }
 
-func (r productRepository) SoftBatchDeleteById(ids []string) (err error) {
+func (r productRepository) RestoreBatchById(ids []string) (response models.BatchRestoreResponse, err error) {
+	response.Restored = []string{}
+	response.Conflicts = []string{}
+	response.NotFound = []string{}
+
+	for _, id := range ids {
+		_, err = r.RestoreById(id)
+
+		switch err {
+		case nil:
+			response.Restored = append(response.Restored, id)
+		case ErrUniqueKeyConflict:
+			response.Conflicts = append(response.Conflicts, id)
+		case ErrProductNotFound:
+			response.NotFound = append(response.NotFound, id)
+		default:
+			return
+		}
+	}
+
+	return response, nil
+}
+
+func (r productRepository) QueryProducts(request models.QueryRequest, opts ...ReadOption) (err error, response models.QueryResponse[models.Product]) {
+	readOptions := buildReadOptions(opts)
+	if readOptions.AsOf != nil {
+		return r.queryProductsAsOf(request, readOptions)
+	}
+
+	filter := r.scoped(readOptions.filter())
+
+	var findOpts options.FindOptions
+	findOpts.
+		SetSkip(request.Offset).
+		SetLimit(request.Rows)
+	if request.SortField != "" && request.SortOrder != 0 {
+		findOpts.SetSort(bson.D{{Key: request.SortField, Value: request.SortOrder}})
+	}
 
-	oids := make([]primitive.ObjectID, len(ids))
-	for i := range ids {
-		oids[i], err = primitive.ObjectIDFromHex(ids[i])
+	curs, err := r.collection.Find(r.context, filter, &findOpts)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for curs.Next(r.context) {
+		var product models.Product
+		err = curs.Decode(&product)
 		if err != nil {
 			log.Println(err)
 			return
 		}
+		response.Result = append(response.Result, product)
 	}
 
-	_, err = r.collection.UpdateMany(r.context, bson.M{"_id": bson.M{"$in": oids}}, bson.M{"$set": bson.M{"updated_at": time.Now(), "deleted": true}})
-
+	totalRecCount, err := r.collection.CountDocuments(r.context, filter)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
+	paginate(request, totalRecCount, &response)
+
 	return
 }
 
-func (r productRepository) QueryProducts(request models.QueryRequest) (err error, response models.QueryResponse[models.Product]) {
+// QueryTrash pages through soft-deleted products, most recently deleted first unless sorted otherwise.
+func (r productRepository) QueryTrash(request models.QueryRequest) (err error, response models.QueryResponse[models.Product]) {
+	filter := r.scoped(bson.M{"deleted": true})
 
 	var opts options.FindOptions
 	opts.
 		SetSkip(request.Offset).
-		SetLimit(request.Rows)
+		SetLimit(request.Rows).
+		SetSort(bson.D{{Key: "deleted_at", Value: -1}})
 	if request.SortField != "" && request.SortOrder != 0 {
-		opts.SetSort(bson.D{{request.SortField, request.SortOrder}})
+		opts.SetSort(bson.D{{Key: request.SortField, Value: request.SortOrder}})
 	}
 
-	curs, err := r.collection.Find(r.context, bson.M{"deleted": nil}, &opts)
+	curs, err := r.collection.Find(r.context, filter, &opts)
+	if err != nil {
+		log.Println(err)
+		return
+	}
 
+	response.Result = []models.Product{}
 	for curs.Next(r.context) {
 		var product models.Product
 		err = curs.Decode(&product)
@@ -167,12 +446,18 @@ func (r productRepository) QueryProducts(request models.QueryRequest) (err error
 		response.Result = append(response.Result, product)
 	}
 
-	totalRecCount, err := r.collection.EstimatedDocumentCount(r.context)
+	totalRecCount, err := r.collection.CountDocuments(r.context, filter)
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
+	paginate(request, totalRecCount, &response)
+
+	return
+}
+
+func paginate[T any](request models.QueryRequest, totalRecCount int64, response *models.QueryResponse[T]) {
 	response.TotalRecordsCount = totalRecCount
 	response.TotalPagesCount = totalRecCount / request.Rows
 	currentRequestedPage := request.Offset / request.Rows
@@ -184,6 +469,43 @@ func (r productRepository) QueryProducts(request models.QueryRequest) (err error
 	response.RecordsPerPageCount = request.Rows
 	response.IsPrev = response.Page > 1
 	response.IsNext = response.Page < response.TotalPagesCount
+}
+
+// MigrateQuantities rewrites quantities still stored as binary floats or integers
+// as Decimal128 values rounded to the scale of the product unit.
+func (r productRepository) MigrateQuantities() (migrated int64, err error) {
+	legacyQuantity := bson.M{"$type": bson.A{"double", "int", "long", "string"}}
+
+	curs, err := r.collection.Find(r.context, bson.M{"quantity": legacyQuantity})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer curs.Close(r.context)
+
+	for curs.Next(r.context) {
+		var product models.Product
+		err = curs.Decode(&product)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		quantity := RoundQuantity(*product.Quantity, product.Unit)
+		res, updErr := r.collection.UpdateOne(r.context,
+			bson.M{"_id": product.Id, "quantity": legacyQuantity},
+			bson.M{"$set": bson.M{"quantity": quantity}})
+		if updErr != nil {
+			log.Println(updErr)
+			return migrated, updErr
+		}
+		migrated += res.ModifiedCount
+	}
+
+	err = curs.Err()
+	if err != nil {
+		log.Println(err)
+	}
 
 	return
 }
@@ -0,0 +1,157 @@
+package logic
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"msrd-products/db"
+	"msrd-products/models"
+	"time"
+)
+
+type PurgeConfig struct {
+	Retention  time.Duration
+	BatchSize  int64
+	MaxBatches int
+	DryRun     bool
+}
+
+// productDependent is a collection holding data that belongs to a product
+// and has to be removed together with it.
+type productDependent struct {
+	name       string
+	collection *mongo.Collection
+	field      string
+}
+
+func productDependents(dbContext db.DbContext) []productDependent {
+	return []productDependent{
+		{"product_history", dbContext.GetProductHistoryCollection(), "product_id"},
+		{"document_lines", dbContext.GetDocumentLinesCollection(), "product_id"},
+	}
+}
+
+// PurgeDeletedProducts hard-deletes products soft-deleted longer than the retention period ago,
+// together with their dependent data. Tombstones written before deleted_at existed fall back to updated_at.
+// Each batch is purged in a transaction, which needs MongoDB running as a replica set.
+// In dry-run mode nothing is deleted and the report only describes what would be purged.
+func PurgeDeletedProducts(ctx context.Context, dbContext db.DbContext, config PurgeConfig) (report models.PurgeReport, err error) {
+	products := dbContext.GetProductsCollection()
+
+	report.Cutoff = time.Now().Add(-config.Retention)
+	report.DryRun = config.DryRun
+	report.Dependents = map[string]int64{}
+	report.SampleIds = []string{}
+
+	filter := bson.M{
+		"deleted": true,
+		"$or": bson.A{
+			bson.M{"deleted_at": bson.M{"$lt": report.Cutoff}},
+			bson.M{"deleted_at": bson.M{"$exists": false}, "updated_at": bson.M{"$lt": report.Cutoff}},
+		},
+	}
+
+	report.Candidates, err = products.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for batch := 0; config.MaxBatches <= 0 || batch < config.MaxBatches; batch++ {
+		var ids []primitive.ObjectID
+		ids, err = findPurgeBatch(ctx, products, filter, config.BatchSize)
+		if err != nil || len(ids) == 0 {
+			return
+		}
+
+		if batch == 0 {
+			for _, id := range ids {
+				report.SampleIds = append(report.SampleIds, id.Hex())
+			}
+		}
+
+		if config.DryRun {
+			return
+		}
+
+		var purged int64
+		var dependents map[string]int64
+		err = dbContext.WithTransaction(ctx, func(ctx context.Context) error {
+			purged, dependents, err = purgeBatch(ctx, dbContext, filter, ids)
+			return err
+		})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		report.Purged += purged
+		for name, count := range dependents {
+			report.Dependents[name] += count
+		}
+	}
+
+	return
+}
+
+// purgeBatch deletes the products of a batch that still match the filter, so products restored
+// in the meantime are kept, and then the dependent data of exactly those products. It runs in a
+// transaction, so a restore either happens before the batch is selected or after it is purged.
+func purgeBatch(ctx context.Context, dbContext db.DbContext, filter bson.M, ids []primitive.ObjectID) (purged int64, dependents map[string]int64, err error) {
+	products := dbContext.GetProductsCollection()
+	dependents = map[string]int64{}
+
+	ids, err = findPurgeBatch(ctx, products, bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$in": ids}}}}, int64(len(ids)))
+	if err != nil || len(ids) == 0 {
+		return
+	}
+
+	res, err := products.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	purged = res.DeletedCount
+
+	for _, dependent := range productDependents(dbContext) {
+		res, err = dependent.collection.DeleteMany(ctx, bson.M{dependent.field: bson.M{"$in": ids}})
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		dependents[dependent.name] = res.DeletedCount
+	}
+
+	return
+}
+
+func findPurgeBatch(ctx context.Context, products *mongo.Collection, filter bson.M, batchSize int64) (ids []primitive.ObjectID, err error) {
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 1}).
+		SetSort(bson.D{{Key: "deleted_at", Value: 1}}).
+		SetLimit(batchSize)
+
+	curs, err := products.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer curs.Close(ctx)
+
+	for curs.Next(ctx) {
+		var doc struct {
+			Id primitive.ObjectID `bson:"_id"`
+		}
+		err = curs.Decode(&doc)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		ids = append(ids, doc.Id)
+	}
+
+	return ids, curs.Err()
+}
@@ -0,0 +1,151 @@
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func idDocuments(ids ...primitive.ObjectID) (documents []bson.D) {
+	for _, id := range ids {
+		documents = append(documents, bson.D{{Key: "_id", Value: id}})
+	}
+	return
+}
+
+func countResponse(n int64) bson.D {
+	return mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+}
+
+func deleteResponse(n int32) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: n})
+}
+
+func TestPurgeDeletedProducts(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("dry run reports without deleting", func(mt *mtest.T) {
+		a, b := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			countResponse(5),
+			mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, idDocuments(a, b)...),
+		)
+
+		report, err := PurgeDeletedProducts(context.Background(), mockDbContext{database: mt.DB},
+			PurgeConfig{Retention: time.Hour, BatchSize: 2, DryRun: true})
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		if !report.DryRun || report.Candidates != 5 || report.Purged != 0 {
+			mt.Errorf("report: %+v", report)
+		}
+		if len(report.SampleIds) != 2 || report.SampleIds[0] != a.Hex() || report.SampleIds[1] != b.Hex() {
+			mt.Errorf("sample ids: %v", report.SampleIds)
+		}
+		if deletes := commandsNamed(mt, "delete"); len(deletes) != 0 {
+			mt.Errorf("dry run sent %d deletes", len(deletes))
+		}
+	})
+
+	mt.Run("stops after the batch limit and purges dependents of purged products only", func(mt *mtest.T) {
+		a, b, c, d := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			countResponse(6),
+			// First batch; b was restored after it was selected.
+			mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, idDocuments(a, b)...),
+			mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, idDocuments(a)...),
+			deleteResponse(1),
+			deleteResponse(3),
+			deleteResponse(2),
+			// Second batch.
+			mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, idDocuments(c, d)...),
+			mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch, idDocuments(c, d)...),
+			deleteResponse(2),
+			deleteResponse(4),
+			deleteResponse(0),
+		)
+
+		report, err := PurgeDeletedProducts(context.Background(), mockDbContext{database: mt.DB},
+			PurgeConfig{Retention: time.Hour, BatchSize: 2, MaxBatches: 2})
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		if report.Candidates != 6 || report.Purged != 3 {
+			mt.Errorf("report: %+v", report)
+		}
+		if report.Dependents["product_history"] != 7 || report.Dependents["document_lines"] != 2 {
+			mt.Errorf("dependents: %v", report.Dependents)
+		}
+
+		for _, find := range commandsNamed(mt, "find") {
+			if limit := find.Lookup("limit").Int64(); limit != 2 {
+				mt.Errorf("find limit: got %d", limit)
+			}
+		}
+		if finds := commandsNamed(mt, "find"); len(finds) != 4 {
+			mt.Errorf("got %d finds, want 4 for two batches", len(finds))
+		}
+
+		deletes := commandsNamed(mt, "delete")
+		if len(deletes) != 6 {
+			mt.Fatalf("got %d deletes, want 6", len(deletes))
+		}
+		collections := []string{"products", "product_history", "document_lines"}
+		for i, command := range deletes {
+			if collection := command.Lookup("delete").StringValue(); collection != collections[i%3] {
+				mt.Errorf("delete %d: got %s, want %s", i, collection, collections[i%3])
+			}
+		}
+		ids, _ := deletes[1].Lookup("deletes").Array().Index(0).Value().Document().Lookup("q", "product_id", "$in").Array().Values()
+		if len(ids) != 1 || ids[0].ObjectID() != a {
+			mt.Errorf("dependents of the first batch deleted for %v, want only %s", ids, a.Hex())
+		}
+	})
+
+	mt.Run("selects only products deleted before the retention cutoff", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			countResponse(0),
+			mtest.CreateCursorResponse(0, "db.products", mtest.FirstBatch),
+		)
+
+		before := time.Now().Add(-48 * time.Hour)
+		report, err := PurgeDeletedProducts(context.Background(), mockDbContext{database: mt.DB},
+			PurgeConfig{Retention: 48 * time.Hour, BatchSize: 10})
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		if report.Cutoff.Before(before) || report.Cutoff.After(time.Now().Add(-48*time.Hour)) {
+			mt.Errorf("cutoff %s is not 48h ago", report.Cutoff)
+		}
+
+		finds := commandsNamed(mt, "find")
+		if len(finds) != 1 {
+			mt.Fatalf("got %d finds", len(finds))
+		}
+		filter := finds[0].Lookup("filter").Document()
+		if !filter.Lookup("deleted").Boolean() {
+			mt.Errorf("filter does not select deleted products: %s", filter)
+		}
+		conditions, _ := filter.Lookup("$or").Array().Values()
+		for _, condition := range conditions {
+			cutoff := condition.Document().Lookup("deleted_at", "$lt")
+			if cutoff.Type == 0 {
+				cutoff = condition.Document().Lookup("updated_at", "$lt")
+			}
+			if !cutoff.Time().Equal(report.Cutoff.Truncate(time.Millisecond)) {
+				mt.Errorf("condition %s does not use the cutoff %s", condition, report.Cutoff)
+			}
+		}
+		if report.Purged != 0 || len(commandsNamed(mt, "delete")) != 0 {
+			mt.Errorf("purged without candidates: %+v", report)
+		}
+	})
+}
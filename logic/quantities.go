@@ -0,0 +1,61 @@
+package logic
+
+import (
+	"log"
+	"msrd-products/models"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const defaultQuantityScale int32 = 3
+
+var (
+	quantityScalesOnce   sync.Once
+	quantityScales       map[string]int32
+	quantityDefaultScale int32
+)
+
+// QuantityScale returns how many fractional digits are kept for quantities of the given unit.
+// Scales are configured as QUANTITY_SCALES=pcs:0,kg:3,l:3 with QUANTITY_DEFAULT_SCALE for unlisted units.
+func QuantityScale(unit string) int32 {
+	quantityScalesOnce.Do(loadQuantityScales)
+
+	if scale, ok := quantityScales[strings.ToLower(unit)]; ok {
+		return scale
+	}
+	return quantityDefaultScale
+}
+
+// RoundQuantity rounds a quantity to the scale of its unit.
+func RoundQuantity(quantity models.Decimal, unit string) models.Decimal {
+	return quantity.Round(QuantityScale(unit))
+}
+
+func loadQuantityScales() {
+	quantityScales = map[string]int32{}
+	quantityDefaultScale = defaultQuantityScale
+
+	if value := os.Getenv("QUANTITY_DEFAULT_SCALE"); value != "" {
+		scale, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || scale < 0 {
+			log.Println("Invalid QUANTITY_DEFAULT_SCALE:", value)
+		} else {
+			quantityDefaultScale = int32(scale)
+		}
+	}
+
+	for _, entry := range strings.Split(os.Getenv("QUANTITY_SCALES"), ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		unit, value, found := strings.Cut(entry, ":")
+		scale, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+		if !found || err != nil || scale < 0 {
+			log.Println("Invalid QUANTITY_SCALES entry:", entry)
+			continue
+		}
+		quantityScales[strings.ToLower(strings.TrimSpace(unit))] = int32(scale)
+	}
+}
@@ -0,0 +1,155 @@
+package logic
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"msrd-products/auth"
+	"msrd-products/db"
+	"msrd-products/models"
+	"time"
+)
+
+type QuarantineRepository interface {
+	Add(event models.DocumentStatusEvent, source *models.EventSource, reason string) (*models.QuarantinedEvent, error)
+	FindById(id string) (*models.QuarantinedEvent, error)
+	Query(request models.QuarantineQueryRequest) (error, models.QueryResponse[models.QuarantinedEvent])
+	RecordAttempt(id primitive.ObjectID, reason string) (*models.QuarantinedEvent, error)
+	MarkReplayed(id primitive.ObjectID) (*models.QuarantinedEvent, error)
+}
+
+type quarantineRepository struct {
+	collection *mongo.Collection
+	context    context.Context
+}
+
+func NewQuarantineRepository(context context.Context, dbContext db.DbContext) QuarantineRepository {
+	return &quarantineRepository{dbContext.GetQuarantinedEventsCollection(), context}
+}
+
+// Add keeps an event that could not be applied. An event whose source is quarantined already is not added twice.
+func (r quarantineRepository) Add(event models.DocumentStatusEvent, source *models.EventSource, reason string) (quarantined *models.QuarantinedEvent, err error) {
+	if source != nil {
+		err = r.collection.FindOne(r.context, bson.M{"source": source}).Decode(&quarantined)
+		if err == nil {
+			return quarantined, nil
+		}
+		if err != mongo.ErrNoDocuments {
+			log.Println(err)
+			return nil, err
+		}
+	}
+
+	quarantined = &models.QuarantinedEvent{
+		Event:         event,
+		Source:        source,
+		Reason:        reason,
+		QuarantinedAt: time.Now(),
+	}
+	if tenant, ok := auth.TenantFromContext(r.context); ok {
+		quarantined.TenantId = tenant
+	}
+
+	res, err := r.collection.InsertOne(r.context, quarantined)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	quarantined.Id = res.InsertedID.(primitive.ObjectID)
+
+	return quarantined, nil
+}
+
+func (r quarantineRepository) FindById(id string) (quarantined *models.QuarantinedEvent, err error) {
+	oid, _ := primitive.ObjectIDFromHex(id)
+
+	err = r.collection.FindOne(r.context, scopeToTenant(r.context, bson.M{"_id": oid})).Decode(&quarantined)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return
+}
+
+// Query pages through quarantined events, most recent first. Replayed events are left out unless asked for.
+func (r quarantineRepository) Query(request models.QuarantineQueryRequest) (err error, response models.QueryResponse[models.QuarantinedEvent]) {
+	filter := bson.M{}
+	if !request.IncludeReplayed {
+		filter["replayed_at"] = bson.M{"$exists": false}
+	}
+	filter = scopeToTenant(r.context, filter)
+
+	var opts options.FindOptions
+	opts.
+		SetSkip(request.Offset).
+		SetLimit(request.Rows).
+		SetSort(bson.D{{Key: "quarantined_at", Value: -1}})
+	if request.SortField != "" && request.SortOrder != 0 {
+		opts.SetSort(bson.D{{Key: request.SortField, Value: request.SortOrder}})
+	}
+
+	curs, err := r.collection.Find(r.context, filter, &opts)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	response.Result = []models.QuarantinedEvent{}
+	err = curs.All(r.context, &response.Result)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	totalRecCount, err := r.collection.CountDocuments(r.context, filter)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	paginate(request.QueryRequest, totalRecCount, &response)
+
+	return
+}
+
+// RecordAttempt counts a replay that failed again, keeping the latest reason.
+func (r quarantineRepository) RecordAttempt(id primitive.ObjectID, reason string) (*models.QuarantinedEvent, error) {
+	return r.update(id, bson.M{
+		"$set": bson.M{"reason": reason, "last_attempt_at": time.Now()},
+		"$inc": bson.M{"attempts": 1},
+	})
+}
+
+func (r quarantineRepository) MarkReplayed(id primitive.ObjectID) (*models.QuarantinedEvent, error) {
+	now := time.Now()
+	return r.update(id, bson.M{
+		"$set": bson.M{"replayed_at": now, "last_attempt_at": now},
+		"$inc": bson.M{"attempts": 1},
+	})
+}
+
+func (r quarantineRepository) update(id primitive.ObjectID, update bson.M) (quarantined *models.QuarantinedEvent, err error) {
+	filter := scopeToTenant(r.context, bson.M{"_id": id, "replayed_at": bson.M{"$exists": false}})
+
+	err = r.collection.FindOneAndUpdate(r.context, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&quarantined)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrEventReplayed
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return
+}
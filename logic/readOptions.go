@@ -0,0 +1,42 @@
+package logic
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+// ReadOptions controls how soft-deleted records are treated by repository reads.
+// By default deleted products are hidden from queries and reported as ErrProductDeleted by lookups.
+// With AsOf set, products are read as they were at that moment, rebuilt from their history.
+type ReadOptions struct {
+	IncludeDeleted bool
+	AsOf           *time.Time
+}
+
+type ReadOption func(options *ReadOptions)
+
+func IncludeDeleted(include bool) ReadOption {
+	return func(options *ReadOptions) {
+		options.IncludeDeleted = include
+	}
+}
+
+func AsOf(asOf time.Time) ReadOption {
+	return func(options *ReadOptions) {
+		options.AsOf = &asOf
+	}
+}
+
+func buildReadOptions(opts []ReadOption) (options ReadOptions) {
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return
+}
+
+func (options ReadOptions) filter() bson.M {
+	if options.IncludeDeleted {
+		return bson.M{}
+	}
+	return bson.M{"deleted": nil}
+}
@@ -0,0 +1,40 @@
+package logic
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"log"
+	"msrd-products/auth"
+	"msrd-products/db"
+)
+
+// scopeToTenant restricts a filter to the tenant of the context. Contexts without a tenant,
+// such as maintenance jobs and events that carry none, are not restricted.
+func scopeToTenant(ctx context.Context, filter bson.M) bson.M {
+	if tenant, ok := auth.TenantFromContext(ctx); ok {
+		filter["tenant_id"] = tenant
+	}
+	return filter
+}
+
+// AssignDefaultTenant gives products and documents stored before multi-tenancy the given tenant.
+func AssignDefaultTenant(ctx context.Context, dbContext db.DbContext, tenant string) (products int64, documents int64, err error) {
+	withoutTenant := bson.M{"tenant_id": bson.M{"$exists": false}}
+	assign := bson.M{"$set": bson.M{"tenant_id": tenant}}
+
+	res, err := dbContext.GetProductsCollection().UpdateMany(ctx, withoutTenant, assign)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	products = res.ModifiedCount
+
+	res, err = dbContext.GetDocumentsCollection().UpdateMany(ctx, withoutTenant, assign)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	documents = res.ModifiedCount
+
+	return
+}
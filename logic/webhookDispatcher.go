@@ -0,0 +1,220 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"msrd-products/db"
+	"msrd-products/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxLoggedAttempts bounds the attempts kept on a delivery; AttemptCount keeps counting past it.
+const maxLoggedAttempts = 20
+
+type WebhookDispatchConfig struct {
+	BatchSize   int
+	Timeout     time.Duration
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// Lease is how long a claimed delivery is hidden from other dispatchers while it is being sent.
+	Lease time.Duration
+	// AllowPrivateHosts lets deliveries reach loopback, link-local and private addresses.
+	AllowPrivateHosts bool
+}
+
+type WebhookDispatchReport struct {
+	Delivered int
+	Retried   int
+	Failed    int
+	// LeaseLost counts attempts not recorded because the lease expired and another dispatcher claimed the delivery.
+	LeaseLost int
+}
+
+// errWebhookLeaseLost reports that a delivery was claimed again while its attempt was being sent.
+var errWebhookLeaseLost = errors.New("webhook delivery lease lost")
+
+// DispatchWebhooks sends up to BatchSize due deliveries. Failed attempts are retried with exponential
+// backoff until MaxAttempts, after which the delivery is marked failed. An attempt is recorded only
+// while the lease of its claim holds, so a slow send cannot overwrite the result of a later claim.
+func DispatchWebhooks(ctx context.Context, dbContext db.DbContext, config WebhookDispatchConfig) (report WebhookDispatchReport, err error) {
+	client := newWebhookClient(config.Timeout, config.AllowPrivateHosts)
+	deliveries := dbContext.GetWebhookDeliveriesCollection()
+
+	for i := 0; i < config.BatchSize; i++ {
+		now := time.Now()
+		var delivery models.WebhookDelivery
+		err = deliveries.FindOneAndUpdate(ctx,
+			bson.M{"status": models.WebhookDeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"next_attempt_at": now.Add(config.Lease), "lease_id": primitive.NewObjectID()}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetReturnDocument(options.After),
+		).Decode(&delivery)
+
+		if err == mongo.ErrNoDocuments {
+			return report, nil
+		}
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		var subscription models.WebhookSubscription
+		err = dbContext.GetWebhookSubscriptionsCollection().FindOne(ctx, bson.M{"_id": delivery.SubscriptionId}).Decode(&subscription)
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Println(err)
+			return
+		}
+
+		attempt := models.WebhookAttempt{At: time.Now()}
+		if err == mongo.ErrNoDocuments || subscription.DeletedAt != nil {
+			attempt.Error = "subscription deleted"
+			err = recordWebhookAttempt(ctx, deliveries, delivery, attempt, models.WebhookDeliveryFailed, nil)
+			if err == nil {
+				report.Failed++
+			}
+		} else {
+			attempt = sendWebhook(ctx, client, subscription, delivery)
+			err = finishWebhookAttempt(ctx, deliveries, delivery, attempt, config, &report)
+		}
+
+		if err == errWebhookLeaseLost {
+			log.Printf("Lease of webhook delivery %s expired before its attempt was recorded", delivery.Id.Hex())
+			report.LeaseLost++
+			err = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	return report, nil
+}
+
+func finishWebhookAttempt(ctx context.Context, deliveries *mongo.Collection, delivery models.WebhookDelivery, attempt models.WebhookAttempt, config WebhookDispatchConfig, report *WebhookDispatchReport) (err error) {
+	if attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode < 300 {
+		if err = recordWebhookAttempt(ctx, deliveries, delivery, attempt, models.WebhookDeliveryDelivered, nil); err == nil {
+			report.Delivered++
+		}
+		return
+	}
+
+	if delivery.AttemptCount+1 >= config.MaxAttempts {
+		if err = recordWebhookAttempt(ctx, deliveries, delivery, attempt, models.WebhookDeliveryFailed, nil); err == nil {
+			report.Failed++
+		}
+		return
+	}
+
+	next := attempt.At.Add(WebhookBackoff(delivery.AttemptCount+1, config.BackoffBase, config.BackoffMax))
+	if err = recordWebhookAttempt(ctx, deliveries, delivery, attempt, models.WebhookDeliveryPending, &next); err == nil {
+		report.Retried++
+	}
+	return
+}
+
+// recordWebhookAttempt stores the attempt and releases the lease, or returns errWebhookLeaseLost when
+// the delivery no longer carries the lease it was claimed with.
+func recordWebhookAttempt(ctx context.Context, deliveries *mongo.Collection, delivery models.WebhookDelivery, attempt models.WebhookAttempt, status string, next *time.Time) error {
+	set := bson.M{"status": status}
+	unset := bson.M{"lease_id": ""}
+	if next != nil {
+		set["next_attempt_at"] = *next
+	} else {
+		unset["next_attempt_at"] = ""
+	}
+	if status == models.WebhookDeliveryDelivered {
+		set["delivered_at"] = attempt.At
+	}
+
+	update := bson.M{
+		"$set":   set,
+		"$unset": unset,
+		"$inc":   bson.M{"attempt_count": 1},
+		"$push":  bson.M{"attempts": bson.M{"$each": bson.A{attempt}, "$slice": -maxLoggedAttempts}},
+	}
+
+	res, err := deliveries.UpdateOne(ctx, bson.M{"_id": delivery.Id, "lease_id": delivery.LeaseId}, update)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errWebhookLeaseLost
+	}
+	return nil
+}
+
+// WebhookBackoff returns the delay before the attempt following the given number of attempts,
+// doubling from base and capped at max.
+func WebhookBackoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+func sendWebhook(ctx context.Context, client *http.Client, subscription models.WebhookSubscription, delivery models.WebhookDelivery) (attempt models.WebhookAttempt) {
+	attempt.At = time.Now()
+	defer func() { attempt.DurationMs = time.Since(attempt.At).Milliseconds() }()
+
+	body, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		attempt.Error = err.Error()
+		return
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Url, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return
+	}
+
+	timestamp := strconv.FormatInt(attempt.At.Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Webhook-Id", delivery.Payload.Id)
+	request.Header.Set("X-Webhook-Delivery", delivery.Id.Hex())
+	request.Header.Set("X-Webhook-Event", delivery.Payload.Type)
+	request.Header.Set("X-Webhook-Timestamp", timestamp)
+	request.Header.Set("X-Webhook-Signature", WebhookSignature(subscription.Secret, timestamp, body))
+
+	response, err := client.Do(request)
+	if err != nil {
+		attempt.Error = err.Error()
+		return
+	}
+	defer response.Body.Close()
+
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", response.StatusCode)
+	}
+	return
+}
+
+// WebhookSignature signs "<timestamp>.<body>" with HMAC-SHA256, so receivers can reject altered
+// or replayed payloads.
+func WebhookSignature(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
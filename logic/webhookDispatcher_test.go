@@ -0,0 +1,79 @@
+package logic
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestDispatchWebhooksLease(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := WebhookDispatchConfig{BatchSize: 5, Timeout: time.Second, MaxAttempts: 3, Lease: time.Minute, AllowPrivateHosts: true}
+	subscriptionId := primitive.NewObjectID()
+	subscription := mtest.CreateCursorResponse(0, "db.webhook_subscriptions", mtest.FirstBatch, bson.D{
+		{Key: "_id", Value: subscriptionId},
+		{Key: "url", Value: server.URL},
+		{Key: "secret", Value: "secret"},
+	})
+	noDelivery := bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}}
+
+	tests := []struct {
+		name    string
+		matched int32
+		report  WebhookDispatchReport
+	}{
+		{"lease held", 1, WebhookDispatchReport{Delivered: 1}},
+		{"lease lost", 0, WebhookDispatchReport{LeaseLost: 1}},
+	}
+
+	for _, test := range tests {
+		mt.Run(test.name, func(mt *mtest.T) {
+			lease := primitive.NewObjectID()
+			mt.AddMockResponses(
+				bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{
+					{Key: "_id", Value: primitive.NewObjectID()},
+					{Key: "subscription_id", Value: subscriptionId},
+					{Key: "status", Value: "pending"},
+					{Key: "lease_id", Value: lease},
+				}}},
+				subscription,
+				mtest.CreateSuccessResponse(bson.E{Key: "n", Value: test.matched}, bson.E{Key: "nModified", Value: test.matched}),
+				noDelivery,
+			)
+
+			report, err := DispatchWebhooks(context.Background(), mockDbContext{database: mt.DB}, config)
+			if err != nil {
+				mt.Fatal(err)
+			}
+			if report != test.report {
+				mt.Errorf("report: got %+v, want %+v", report, test.report)
+			}
+
+			claim := commandsNamed(mt, "findAndModify")[0].Lookup("update", "$set").Document()
+			if _, err := claim.LookupErr("lease_id"); err != nil {
+				mt.Errorf("claim %s sets no lease", claim)
+			}
+			updates := commandsNamed(mt, "update")
+			if len(updates) != 1 {
+				mt.Fatalf("got %d updates", len(updates))
+			}
+			filter := updates[0].Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+			if value, err := filter.LookupErr("lease_id"); err != nil || value.ObjectID() != lease {
+				mt.Errorf("attempt filter %s does not hold the lease", filter)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// publicWebhookIP reports whether webhooks may be sent to the address. Loopback, link-local, private
+// and unspecified addresses are refused, so subscriptions cannot reach the service's own network.
+func publicWebhookIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+// CheckWebhookUrl returns ErrWebhookUrlNotAllowed unless the URL is http or https and its host
+// resolves only to public addresses. allowPrivate skips the address check, for local development.
+func CheckWebhookUrl(ctx context.Context, rawUrl string, allowPrivate bool) error {
+	target, err := url.Parse(rawUrl)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return ErrWebhookUrlNotAllowed
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	if ip := net.ParseIP(target.Hostname()); ip != nil {
+		if !publicWebhookIP(ip) {
+			return ErrWebhookUrlNotAllowed
+		}
+		return nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, target.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWebhookUrlNotAllowed, err)
+	}
+	for _, address := range addresses {
+		if !publicWebhookIP(address.IP) {
+			return ErrWebhookUrlNotAllowed
+		}
+	}
+
+	return nil
+}
+
+// newWebhookClient returns a client that checks every address it connects to, including those of
+// redirects and of hosts whose DNS records changed after the subscription was created.
+func newWebhookClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = webhookDialControl
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the webhook host and hide it from the check.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+func webhookDialControl(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicWebhookIP(ip) {
+		return fmt.Errorf("%w: %s", ErrWebhookUrlNotAllowed, address)
+	}
+	return nil
+}
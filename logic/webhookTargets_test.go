@@ -0,0 +1,66 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckWebhookUrl(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://[2606:4700::1111]:8080/hook", true},
+		{"http://127.0.0.1/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://172.16.0.1/hook", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://[fd00::1]/hook", false},
+		{"http://[::ffff:127.0.0.1]/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://localhost/hook", false},
+		{"ftp://93.184.216.34/hook", false},
+	}
+
+	for _, test := range tests {
+		err := CheckWebhookUrl(context.Background(), test.url, false)
+		if test.allowed && err != nil {
+			t.Errorf("%s: got %s", test.url, err)
+		}
+		if !test.allowed && !errors.Is(err, ErrWebhookUrlNotAllowed) {
+			t.Errorf("%s: got %v, want ErrWebhookUrlNotAllowed", test.url, err)
+		}
+	}
+
+	if err := CheckWebhookUrl(context.Background(), "http://127.0.0.1/hook", true); err != nil {
+		t.Errorf("private hosts allowed: got %s", err)
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	_, err := newWebhookClient(time.Second, false).Get(server.URL)
+	if !errors.Is(err, ErrWebhookUrlNotAllowed) {
+		t.Errorf("got %v, want ErrWebhookUrlNotAllowed", err)
+	}
+
+	response, err := newWebhookClient(time.Second, true).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNoContent {
+		t.Errorf("got status %d", response.StatusCode)
+	}
+}
@@ -0,0 +1,301 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"msrd-products/auth"
+	"msrd-products/db"
+	"msrd-products/models"
+	"msrd-products/utils"
+	"time"
+)
+
+const duplicateKeyCode = 11000
+
+type WebhooksRepository interface {
+	CreateSubscription(request models.CreateWebhookSubscriptionRequest) (*models.CreatedWebhookSubscription, error)
+	ListSubscriptions() ([]models.WebhookSubscription, error)
+	DeleteSubscription(id string) (*models.WebhookSubscription, error)
+	QueryDeliveries(request models.WebhookDeliveryQueryRequest) (error, models.QueryResponse[models.WebhookDelivery])
+	FindDelivery(id string) (*models.WebhookDelivery, error)
+	Redeliver(id string) (*models.WebhookDelivery, error)
+}
+
+type webhooksRepository struct {
+	subscriptions *mongo.Collection
+	deliveries    *mongo.Collection
+	context       context.Context
+}
+
+func NewWebhooksRepository(context context.Context, dbContext db.DbContext) WebhooksRepository {
+	return &webhooksRepository{dbContext.GetWebhookSubscriptionsCollection(), dbContext.GetWebhookDeliveriesCollection(), context}
+}
+
+// CreateSubscription stores a subscription for the tenant of the context. Without a secret in the
+// request a random one is generated. URLs of hosts that are not public are refused with
+// ErrWebhookUrlNotAllowed unless WEBHOOK_ALLOW_PRIVATE_HOSTS is set.
+func (r webhooksRepository) CreateSubscription(request models.CreateWebhookSubscriptionRequest) (created *models.CreatedWebhookSubscription, err error) {
+	err = CheckWebhookUrl(r.context, request.Url, utils.BoolEnv("WEBHOOK_ALLOW_PRIVATE_HOSTS", false))
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := models.WebhookSubscription{
+		Url:       request.Url,
+		Statuses:  request.Statuses,
+		Secret:    request.Secret,
+		CreatedAt: time.Now(),
+	}
+	subscription.TenantId, _ = auth.TenantFromContext(r.context)
+	if actor, ok := auth.ActorFromContext(r.context); ok {
+		subscription.CreatedBy = &actor
+	}
+
+	if subscription.Secret == "" {
+		secret := make([]byte, 32)
+		_, err = rand.Read(secret)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		subscription.Secret = hex.EncodeToString(secret)
+	}
+
+	res, err := r.subscriptions.InsertOne(r.context, subscription)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	subscription.Id = res.InsertedID.(primitive.ObjectID)
+
+	return &models.CreatedWebhookSubscription{WebhookSubscription: subscription, Secret: subscription.Secret}, nil
+}
+
+func (r webhooksRepository) ListSubscriptions() (subscriptions []models.WebhookSubscription, err error) {
+	curs, err := r.subscriptions.Find(r.context, scopeToTenant(r.context, bson.M{"deleted_at": nil}),
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	subscriptions = []models.WebhookSubscription{}
+	err = curs.All(r.context, &subscriptions)
+	if err != nil {
+		log.Println(err)
+	}
+
+	return
+}
+
+// DeleteSubscription stops new deliveries to a subscription. It is kept so its delivery log stays readable.
+func (r webhooksRepository) DeleteSubscription(id string) (subscription *models.WebhookSubscription, err error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	err = r.subscriptions.FindOneAndUpdate(r.context,
+		scopeToTenant(r.context, bson.M{"_id": oid, "deleted_at": nil}),
+		bson.M{"$set": bson.M{"deleted_at": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&subscription)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookNotFound
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return
+}
+
+// QueryDeliveries pages through the delivery log, most recent first unless sorted otherwise.
+func (r webhooksRepository) QueryDeliveries(request models.WebhookDeliveryQueryRequest) (err error, response models.QueryResponse[models.WebhookDelivery]) {
+	filter := bson.M{}
+	if request.SubscriptionId != "" {
+		filter["subscription_id"], _ = primitive.ObjectIDFromHex(request.SubscriptionId)
+	}
+	if request.DocumentId != "" {
+		filter["payload.document_id"] = request.DocumentId
+	}
+	if request.Status != "" {
+		filter["status"] = request.Status
+	}
+	filter = scopeToTenant(r.context, filter)
+
+	var opts options.FindOptions
+	opts.
+		SetSkip(request.Offset).
+		SetLimit(request.Rows).
+		SetSort(bson.D{{Key: "created_at", Value: -1}})
+	if request.SortField != "" && request.SortOrder != 0 {
+		opts.SetSort(bson.D{{Key: request.SortField, Value: request.SortOrder}})
+	}
+
+	curs, err := r.deliveries.Find(r.context, filter, &opts)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	response.Result = []models.WebhookDelivery{}
+	err = curs.All(r.context, &response.Result)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	totalRecCount, err := r.deliveries.CountDocuments(r.context, filter)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	paginate(request.QueryRequest, totalRecCount, &response)
+
+	return
+}
+
+func (r webhooksRepository) FindDelivery(id string) (delivery *models.WebhookDelivery, err error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	err = r.deliveries.FindOne(r.context, scopeToTenant(r.context, bson.M{"_id": oid})).Decode(&delivery)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookNotFound
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return
+}
+
+// Redeliver queues a delivery to be sent again right away, with a fresh retry budget.
+// Its earlier attempts stay in the log.
+func (r webhooksRepository) Redeliver(id string) (delivery *models.WebhookDelivery, err error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	err = r.deliveries.FindOneAndUpdate(r.context,
+		scopeToTenant(r.context, bson.M{"_id": oid}),
+		bson.M{
+			"$set":   bson.M{"status": models.WebhookDeliveryPending, "attempt_count": 0, "next_attempt_at": time.Now()},
+			"$unset": bson.M{"delivered_at": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&delivery)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookNotFound
+	}
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	return
+}
+
+// EnqueueStatusWebhooks queues a delivery of a status change to every subscription of the document's tenant
+// listening for the new status. Queuing the same change again adds no deliveries.
+func EnqueueStatusWebhooks(ctx context.Context, dbContext db.DbContext, document *models.Document, change models.DocumentStatusChange) error {
+	filter := bson.M{
+		"deleted_at": nil,
+		"statuses":   bson.M{"$in": bson.A{change.To, "*"}},
+		"tenant_id":  document.TenantId,
+	}
+	if document.TenantId == "" {
+		filter["tenant_id"] = bson.M{"$exists": false}
+	}
+
+	curs, err := dbContext.GetWebhookSubscriptionsCollection().Find(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	var subscriptions []models.WebhookSubscription
+	err = curs.All(ctx, &subscriptions)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	payload := models.WebhookPayload{
+		Id:         webhookEventId(document.Id, change),
+		Type:       models.WebhookEventDocumentStatusChanged,
+		TenantId:   document.TenantId,
+		DocumentId: document.Id.Hex(),
+		From:       change.From,
+		To:         change.To,
+		Timestamp:  change.Timestamp,
+		Source:     change.Source,
+	}
+
+	now := time.Now()
+	var deliveries []interface{}
+	for _, subscription := range subscriptions {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			TenantId:       subscription.TenantId,
+			SubscriptionId: subscription.Id,
+			Payload:        payload,
+			Status:         models.WebhookDeliveryPending,
+			Attempts:       []models.WebhookAttempt{},
+			NextAttemptAt:  &now,
+			CreatedAt:      now,
+		})
+	}
+
+	_, err = dbContext.GetWebhookDeliveriesCollection().InsertMany(ctx, deliveries, options.InsertMany().SetOrdered(false))
+	if err != nil && !onlyDuplicateKeys(err) {
+		log.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// webhookEventId identifies a status change by the message it came from, so redelivered messages
+// map to the same event.
+func webhookEventId(documentId primitive.ObjectID, change models.DocumentStatusChange) string {
+	if change.Source != nil {
+		return fmt.Sprintf("%s:%s:%d:%d", documentId.Hex(), change.Source.Topic, change.Source.Partition, change.Source.Offset)
+	}
+	return fmt.Sprintf("%s:%d", documentId.Hex(), change.Timestamp.UnixNano())
+}
+
+func onlyDuplicateKeys(err error) bool {
+	bulkErr, ok := err.(mongo.BulkWriteException)
+	if !ok || bulkErr.WriteConcernError != nil {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != duplicateKeyCode {
+			return false
+		}
+	}
+	return true
+}
@@ -1,20 +1,26 @@
 package main
 
 import (
+	"context"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
-	jwtware "github.com/gofiber/jwt/v3"
 	"github.com/gofiber/swagger"
 	"github.com/joho/godotenv"
 	"log"
+	"msrd-products/auth"
 	"msrd-products/db"
 	_ "msrd-products/docs"
+	"msrd-products/jobs"
+	intrnalKafka "msrd-products/kafka"
 	"msrd-products/kafka/consumers"
+	"msrd-products/logic"
+	"msrd-products/middleware"
 	"msrd-products/routes"
 	"msrd-products/utils"
 	"os"
+	"time"
 )
 
 func main() {
@@ -25,7 +31,9 @@ func main() {
 		}
 	}
 
-	dbContext, err := db.BuildDbContext(os.Getenv("DB_CONNECTION_STRING"), os.Getenv("DATABASE"), func(config *db.DbContextConfig) {})
+	dbContext, err := db.BuildDbContext(os.Getenv("DB_CONNECTION_STRING"), os.Getenv("DATABASE"), func(config *db.DbContextConfig) {
+		config.IdempotencyKeyTTL = utils.DurationEnv("IDEMPOTENCY_KEY_TTL", config.IdempotencyKeyTTL)
+	})
 
 	if err != nil {
 		log.Fatal("Error loading database")
@@ -41,6 +49,56 @@ func main() {
 		return
 	}
 
+	if os.Getenv("APP_MODE") == "DOCUMENT_LINES_CONSUMER" {
+		consumers.LaunchDocumentLinesConsumer(dbContext)
+		return
+	}
+
+	if os.Getenv("APP_MODE") == "WEBHOOK_DISPATCHER" {
+		jobs.LaunchWebhookDispatcher(dbContext)
+		return
+	}
+
+	if os.Getenv("APP_MODE") == "DLT_REDRIVE" {
+		topic := os.Getenv("DLT_REDRIVE_TOPIC")
+		if topic == "" {
+			log.Fatal("DLT_REDRIVE_TOPIC is required to redrive dead letters")
+		}
+		redriven, err := intrnalKafka.Redrive(topic, utils.IntEnv("DLT_REDRIVE_LIMIT", 0), utils.DurationEnv("DLT_REDRIVE_IDLE_TIMEOUT", 10*time.Second))
+		if err != nil {
+			log.Fatal("Error redriving dead letters: ", err)
+		}
+		log.Printf("Redrove %d messages from %s", redriven, intrnalKafka.DeadLetterTopic(topic))
+		return
+	}
+
+	if os.Getenv("APP_MODE") == "PRODUCTS_PURGE" {
+		jobs.LaunchProductPurgeJob(dbContext)
+		return
+	}
+
+	if os.Getenv("APP_MODE") == "MIGRATE_QUANTITIES" {
+		migrated, err := logic.NewProductsRepository(context.Background(), dbContext).MigrateQuantities()
+		if err != nil {
+			log.Fatal("Error migrating quantities: ", err)
+		}
+		log.Printf("Migrated %d product quantities to Decimal128", migrated)
+		return
+	}
+
+	if os.Getenv("APP_MODE") == "MIGRATE_TENANTS" {
+		tenant := os.Getenv("DEFAULT_TENANT")
+		if tenant == "" {
+			log.Fatal("DEFAULT_TENANT is required to migrate tenants")
+		}
+		products, documents, err := logic.AssignDefaultTenant(context.Background(), dbContext, tenant)
+		if err != nil {
+			log.Fatal("Error migrating tenants: ", err)
+		}
+		log.Printf("Assigned tenant %s to %d products and %d documents", tenant, products, documents)
+		return
+	}
+
 	app := fiber.New()
 	app.Use(recover.New())
 	app.Use(func(c *fiber.Ctx) error {
@@ -52,14 +110,13 @@ func main() {
 
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
-	authMiddleware := jwtware.New(jwtware.Config{
-		TokenLookup: "header:Authorization",
-		AuthScheme:  "Bearer",
-		KeySetURLs: []string{
-			os.Getenv("JWSK_URL"),
-		},
-	})
-	app.Use(authMiddleware)
+	authMiddleware, err := auth.JWTMiddleware(auth.JWTConfigFromEnv())
+	if err != nil {
+		log.Fatal("Error configuring JWT validation: ", err)
+	}
+	app.Use(middleware.ApiKeyOrJWT(authMiddleware))
+	app.Use(auth.ActorMiddleware())
+	app.Use(auth.TenantMiddleware())
 
 	routes.SetupRoutes(app)
 
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"msrd-products/auth"
+	"msrd-products/db"
+	"msrd-products/logic"
+	"msrd-products/utils"
+	"time"
+)
+
+const HeaderApiKey = "X-API-Key"
+
+// ApiKeyOrJWT authenticates requests carrying an API key in the header named by API_KEY_HEADER
+// and hands every other request to the JWT middleware.
+func ApiKeyOrJWT(jwtMiddleware fiber.Handler) fiber.Handler {
+	header := utils.StringEnv("API_KEY_HEADER", HeaderApiKey)
+	lastUsedResolution := utils.DurationEnv("API_KEY_LAST_USED_RESOLUTION", time.Minute)
+
+	return func(c *fiber.Ctx) error {
+		key := c.Get(header)
+		if key == "" {
+			return jwtMiddleware(c)
+		}
+
+		dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+		if dbContext == nil {
+			return c.Status(fiber.StatusInternalServerError).Send(nil)
+		}
+
+		apiKey, err := logic.NewApiKeysRepository(c.UserContext(), dbContext).Authenticate(key, lastUsedResolution)
+
+		if err == logic.ErrApiKeyInvalid {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).Send(nil)
+		}
+
+		c.Locals("user", auth.ApiKeyToken(apiKey.Id.Hex(), apiKey.Name, apiKey.TenantId, apiKey.Scopes))
+		return c.Next()
+	}
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gofiber/fiber/v2"
+	"msrd-products/auth"
+	"msrd-products/db"
+	"msrd-products/logic"
+	"msrd-products/models"
+	"msrd-products/utils"
+	"time"
+)
+
+const (
+	HeaderIdempotencyKey      = "Idempotency-Key"
+	HeaderIdempotentReplayed  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	defaultIdempotencyTimeout = time.Minute
+)
+
+// replayedHeaders are stored with a response so replays look like the original.
+var replayedHeaders = []string{fiber.HeaderContentType, fiber.HeaderETag, fiber.HeaderLocation}
+
+// Idempotency makes a write endpoint safe to retry. The first request with a given Idempotency-Key
+// is processed and its response stored; replays of the same request get the stored status and body,
+// while reusing the key for a different request is rejected with 422.
+func Idempotency() fiber.Handler {
+	lockTimeout := utils.DurationEnv("IDEMPOTENCY_LOCK_TIMEOUT", defaultIdempotencyTimeout)
+
+	return func(c *fiber.Ctx) error {
+		key := c.Get(HeaderIdempotencyKey)
+		if key == "" {
+			return c.Next()
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Idempotency-Key is too long",
+			})
+		}
+
+		dbContext := utils.GetLocal[db.DbContext](c, "db_context")
+		if dbContext == nil {
+			return c.Status(fiber.StatusInternalServerError).Send(nil)
+		}
+		idemRep := logic.NewIdempotencyRepository(c.UserContext(), dbContext)
+
+		actor, _ := auth.ActorFromContext(c.UserContext())
+		tenant, _ := auth.TenantFromContext(c.UserContext())
+		id := models.IdempotencyKeyId{Tenant: tenant, Actor: actor.Id, Key: key}
+
+		existing, claimed, err := idemRep.Begin(models.IdempotencyRecord{
+			Id:          id,
+			RequestHash: requestHash(c),
+			Method:      c.Method(),
+			Path:        c.Path(),
+		}, lockTimeout)
+
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).Send(nil)
+		}
+
+		if !claimed {
+			return replay(c, existing)
+		}
+
+		err = c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil || status >= fiber.StatusInternalServerError {
+			_ = idemRep.Release(id)
+			return err
+		}
+
+		header := map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := c.GetRespHeader(name); value != "" {
+				header[name] = value
+			}
+		}
+
+		body := append([]byte(nil), c.Response().Body()...)
+		if completeErr := idemRep.Complete(id, status, body, header); completeErr != nil {
+			_ = idemRep.Release(id)
+		}
+
+		return nil
+	}
+}
+
+func replay(c *fiber.Ctx, record *models.IdempotencyRecord) error {
+	if record.RequestHash != requestHash(c) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "Idempotency-Key has already been used for a different request",
+		})
+	}
+
+	if record.Status != models.IdempotencyCompleted {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "A request with this Idempotency-Key is still being processed",
+		})
+	}
+
+	for name, value := range record.ResponseHeader {
+		c.Set(name, value)
+	}
+	c.Set(HeaderIdempotentReplayed, "true")
+
+	return c.Status(record.ResponseStatus).Send(record.ResponseBody)
+}
+
+// requestHash fingerprints everything that makes two requests with the same key different.
+func requestHash(c *fiber.Ctx) string {
+	hash := sha256.New()
+	for _, part := range []string{c.Method(), c.Path(), c.Get(fiber.HeaderContentType), c.Get(fiber.HeaderIfMatch)} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(c.Body())
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,7 @@
+package models
+
+// Actor identifies who made a change.
+type Actor struct {
+	Id   string `json:"id" bson:"id"`
+	Name string `json:"name,omitempty" bson:"name,omitempty"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ApiKey lets another service call the API without an interactive login. Only a hash of the key
+// is stored; the key itself is returned once, when it is issued.
+type ApiKey struct {
+	Id         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	TenantId   string              `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	Name       string              `json:"name" bson:"name"`
+	Prefix     string              `json:"prefix" bson:"prefix"`
+	Hash       string              `json:"-" bson:"hash"`
+	Scopes     []string            `json:"scopes" bson:"scopes"`
+	ExpiresAt  *time.Time          `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	CreatedAt  time.Time           `json:"created_at" bson:"created_at"`
+	CreatedBy  *Actor              `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	LastUsedAt *time.Time          `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	RevokedAt  *time.Time          `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	ReplacedBy *primitive.ObjectID `json:"replaced_by,omitempty" bson:"replaced_by,omitempty"`
+}
+
+type CreateApiKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// IssuedApiKey carries the plain key, which cannot be retrieved again later.
+type IssuedApiKey struct {
+	ApiKey
+	Key string `json:"key"`
+}
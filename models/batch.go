@@ -0,0 +1,41 @@
+package models
+
+const (
+	BatchModeAtomic     = "atomic"
+	BatchModeBestEffort = "bestEffort"
+
+	BatchOpCreate = "create"
+	BatchOpUpdate = "update"
+	BatchOpDelete = "delete"
+)
+
+type BatchRequest struct {
+	Mode       string           `json:"mode" validate:"omitempty,oneof=atomic bestEffort"`
+	Operations []BatchOperation `json:"operations" validate:"required,min=1,max=100,dive"`
+}
+
+// BatchOperation creates a product from its fields, replaces the fields of the product with Id
+// if it is still at Version, or deletes the product with Id. An update without Unit keeps the unit.
+type BatchOperation struct {
+	Op          string  `json:"op" validate:"required,oneof=create update delete"`
+	Id          string  `json:"id,omitempty" validate:"required_unless=Op create"`
+	Version     *int64  `json:"version,omitempty" validate:"required_if=Op update"`
+	Name        string  `json:"name,omitempty" validate:"required_unless=Op delete"`
+	Description string  `json:"description,omitempty"`
+	Unit        *string `json:"unit,omitempty"`
+}
+
+type BatchOperationResult struct {
+	Index   int      `json:"index"`
+	Op      string   `json:"op"`
+	Id      string   `json:"id,omitempty"`
+	Status  int      `json:"status"`
+	Error   string   `json:"error,omitempty"`
+	Product *Product `json:"product,omitempty"`
+}
+
+type BatchResponse struct {
+	Mode      string                 `json:"mode"`
+	Committed bool                   `json:"committed"`
+	Results   []BatchOperationResult `json:"results"`
+}
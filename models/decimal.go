@@ -0,0 +1,196 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidDecimal = errors.New("invalid decimal value")
+
+// Decimal is an exact decimal number stored as a Mongo Decimal128.
+// In JSON it is written as a number literal and accepted either as a number or as a string,
+// so no precision is lost on the way in or out. The zero value is 0.
+type Decimal struct {
+	value primitive.Decimal128
+}
+
+var zeroDecimal128, _ = primitive.ParseDecimal128("0")
+
+func ParseDecimal(s string) (Decimal, error) {
+	d, err := primitive.ParseDecimal128(strings.TrimSpace(s))
+	if err != nil || d.IsNaN() || d.IsInf() != 0 {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	return Decimal{d}, nil
+}
+
+// DecimalFromFloat converts a legacy binary float using its shortest decimal representation.
+// The result usually still carries float noise and should be rounded to the scale of its unit.
+func DecimalFromFloat(f float64) (Decimal, error) {
+	return ParseDecimal(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// decimal128 returns the stored value, reading the zero Decimal as 0 rather than as the
+// Decimal128 with all bits cleared, which carries the smallest possible exponent.
+func (d Decimal) decimal128() primitive.Decimal128 {
+	if d.value == (primitive.Decimal128{}) {
+		return zeroDecimal128
+	}
+	return d.value
+}
+
+func (d Decimal) bigInt() (*big.Int, int) {
+	bi, exp, err := d.decimal128().BigInt()
+	if err != nil {
+		return new(big.Int), 0
+	}
+	return bi, exp
+}
+
+// Round returns d rounded half away from zero to exactly scale fractional digits.
+func (d Decimal) Round(scale int32) Decimal {
+	bi, exp := d.bigInt()
+	target := -int(scale)
+
+	switch {
+	case exp < target:
+		divisor := pow10(target - exp)
+		quotient, remainder := new(big.Int).QuoRem(bi, divisor, new(big.Int))
+		if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(divisor) >= 0 {
+			quotient.Add(quotient, big.NewInt(int64(bi.Sign())))
+		}
+		bi = quotient
+	case exp > target:
+		bi.Mul(bi, pow10(exp-target))
+	}
+
+	rounded, ok := primitive.ParseDecimal128FromBigInt(bi, target)
+	if !ok {
+		return d
+	}
+	return Decimal{rounded}
+}
+
+func (d Decimal) Cmp(other Decimal) int {
+	return d.rat().Cmp(other.rat())
+}
+
+func (d Decimal) Equal(other Decimal) bool {
+	return d.Cmp(other) == 0
+}
+
+func (d Decimal) IsZero() bool {
+	return d.value.IsZero()
+}
+
+func (d Decimal) Decimal128() primitive.Decimal128 {
+	return d.decimal128()
+}
+
+func (d Decimal) rat() *big.Rat {
+	bi, exp := d.bigInt()
+	if exp < 0 {
+		return new(big.Rat).SetFrac(bi, pow10(-exp))
+	}
+	return new(big.Rat).SetInt(bi.Mul(bi, pow10(exp)))
+}
+
+// String formats d in plain notation, keeping trailing zeros of its scale.
+func (d Decimal) String() string {
+	bi, exp := d.bigInt()
+	negative := bi.Sign() < 0
+	digits := new(big.Int).Abs(bi).String()
+
+	if exp >= 0 {
+		digits += strings.Repeat("0", exp)
+	} else {
+		fraction := -exp
+		if len(digits) <= fraction {
+			digits = strings.Repeat("0", fraction-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-fraction] + "." + digits[len(digits)-fraction:]
+	}
+
+	if negative {
+		return "-" + digits
+	}
+	return digits
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		data = []byte(s)
+	}
+
+	parsed, err := ParseDecimal(string(data))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Decimal) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bsontype.Decimal128, bsoncore.AppendDecimal128(nil, d.decimal128()), nil
+}
+
+// UnmarshalBSONValue also accepts the numeric types quantities were stored as
+// before the Decimal128 migration, so old documents stay readable.
+func (d *Decimal) UnmarshalBSONValue(t bsontype.Type, data []byte) (err error) {
+	switch t {
+	case bsontype.Decimal128:
+		value, _, ok := bsoncore.ReadDecimal128(data)
+		if !ok {
+			return ErrInvalidDecimal
+		}
+		*d = Decimal{value}
+	case bsontype.Double:
+		value, _, ok := bsoncore.ReadDouble(data)
+		if !ok {
+			return ErrInvalidDecimal
+		}
+		*d, err = DecimalFromFloat(value)
+	case bsontype.Int32:
+		value, _, ok := bsoncore.ReadInt32(data)
+		if !ok {
+			return ErrInvalidDecimal
+		}
+		*d, err = ParseDecimal(strconv.FormatInt(int64(value), 10))
+	case bsontype.Int64:
+		value, _, ok := bsoncore.ReadInt64(data)
+		if !ok {
+			return ErrInvalidDecimal
+		}
+		*d, err = ParseDecimal(strconv.FormatInt(value, 10))
+	case bsontype.String:
+		value, _, ok := bsoncore.ReadString(data)
+		if !ok {
+			return ErrInvalidDecimal
+		}
+		*d, err = ParseDecimal(value)
+	default:
+		return fmt.Errorf("%w: cannot decode %s", ErrInvalidDecimal, t)
+	}
+	return
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestZeroDecimal(t *testing.T) {
+	var zero Decimal
+
+	if s := zero.String(); s != "0" {
+		t.Errorf("String: got %q", s)
+	}
+
+	data, err := json.Marshal(zero)
+	if err != nil || string(data) != "0" {
+		t.Errorf("MarshalJSON: got %s, %v", data, err)
+	}
+
+	if !zero.IsZero() || !zero.Equal(Decimal{}.Round(3)) {
+		t.Errorf("zero is not 0")
+	}
+	if s := zero.Round(3).String(); s != "0.000" {
+		t.Errorf("Round: got %q", s)
+	}
+
+	raw, err := bson.Marshal(bson.M{"quantity": zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Quantity Decimal `bson:"quantity"`
+	}
+	if err = bson.Unmarshal(raw, &decoded); err != nil || decoded.Quantity.String() != "0" {
+		t.Errorf("BSON round trip: got %s, %v", decoded.Quantity, err)
+	}
+}
@@ -2,14 +2,90 @@ package models
 
 import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
 )
 
+// Document carries its status changes in StatusHistory, which is served by its own endpoint.
+// Stub documents were created from a status event received before the document itself.
 type Document struct {
-	Id     primitive.ObjectID `bson:"_id" validate:"required"`
-	Status string             `bson:"status"`
+	Id            primitive.ObjectID     `json:"id" bson:"_id" validate:"required"`
+	TenantId      string                 `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	Status        string                 `json:"status" bson:"status"`
+	Stub          bool                   `json:"stub,omitempty" bson:"stub,omitempty"`
+	CreatedAt     *time.Time             `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt     *time.Time             `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	StatusHistory []DocumentStatusChange `json:"-" bson:"status_history,omitempty"`
 }
 
 type UpdateDocumentEvent struct {
 	Id     primitive.ObjectID `bson:"_id" validate:"required"`
 	Status string             `bson:"status"`
+	Source *EventSource       `bson:"source,omitempty"`
+}
+
+// EventSource locates the message an event-driven change came from.
+type EventSource struct {
+	Topic     string `json:"topic" bson:"topic"`
+	Partition int32  `json:"partition" bson:"partition"`
+	Offset    int64  `json:"offset" bson:"offset"`
+}
+
+// DocumentStatusChange records one status event. Illegal changes are recorded but not applied, and so are
+// superseded ones, which arrived after a later status of the document.
+type DocumentStatusChange struct {
+	From       string       `json:"from" bson:"from"`
+	To         string       `json:"to" bson:"to"`
+	Timestamp  time.Time    `json:"timestamp" bson:"timestamp"`
+	Source     *EventSource `json:"source,omitempty" bson:"source,omitempty"`
+	Illegal    bool         `json:"illegal,omitempty" bson:"illegal,omitempty"`
+	Superseded bool         `json:"superseded,omitempty" bson:"superseded,omitempty"`
+}
+
+// DocumentFilter narrows documents to a status and to a range of the time their status last changed.
+type DocumentFilter struct {
+	Status      string     `json:"status,omitempty"`
+	UpdatedFrom *time.Time `json:"updatedFrom,omitempty"`
+	UpdatedTo   *time.Time `json:"updatedTo,omitempty"`
+}
+
+type DocumentQueryRequest struct {
+	QueryRequest
+	DocumentFilter
+}
+
+type DocumentStatusCount struct {
+	Status string `json:"status" bson:"_id"`
+	Count  int64  `json:"count" bson:"count"`
+}
+
+// DocumentStatusEvent is a status received for a document from the stock service.
+// Created marks the event announcing the document itself, rather than a later status change.
+type DocumentStatusEvent struct {
+	DocumentId string `json:"document_id" bson:"document_id"`
+	Status     string `json:"status" bson:"status"`
+	TenantId   string `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	Created    bool   `json:"created,omitempty" bson:"created,omitempty"`
+}
+
+// QuarantinedEvent is a status event that could not be applied, kept until it is replayed.
+type QuarantinedEvent struct {
+	Id            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	TenantId      string              `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	Event         DocumentStatusEvent `json:"event" bson:"event"`
+	Source        *EventSource        `json:"source,omitempty" bson:"source,omitempty"`
+	Reason        string              `json:"reason" bson:"reason"`
+	QuarantinedAt time.Time           `json:"quarantined_at" bson:"quarantined_at"`
+	Attempts      int                 `json:"attempts" bson:"attempts"`
+	LastAttemptAt *time.Time          `json:"last_attempt_at,omitempty" bson:"last_attempt_at,omitempty"`
+	ReplayedAt    *time.Time          `json:"replayed_at,omitempty" bson:"replayed_at,omitempty"`
+}
+
+type QuarantineQueryRequest struct {
+	QueryRequest
+	IncludeReplayed bool `json:"includeReplayed,omitempty" query:"includeReplayed"`
+}
+
+type QuarantineReplayResponse struct {
+	Event    *QuarantinedEvent `json:"event"`
+	Document *Document         `json:"document,omitempty"`
 }
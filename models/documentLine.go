@@ -0,0 +1,30 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	DocumentLineIn  = "in"
+	DocumentLineOut = "out"
+)
+
+// DocumentLine moves a quantity of a product into or out of stock. Its id is the id of the
+// line in the stock service.
+type DocumentLine struct {
+	Id         string             `json:"id" bson:"_id"`
+	TenantId   string             `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	DocumentId primitive.ObjectID `json:"document_id" bson:"document_id"`
+	ProductId  primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Quantity   *Decimal           `json:"quantity" bson:"quantity" swaggertype:"number"`
+	Direction  string             `json:"direction" bson:"direction" enums:"in,out"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// PendingQuantities sums the lines of a product whose documents are not finalized yet.
+type PendingQuantities struct {
+	ProductId primitive.ObjectID `bson:"_id"`
+	Incoming  Decimal            `bson:"incoming"`
+	Outgoing  Decimal            `bson:"outgoing"`
+}
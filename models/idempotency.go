@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+const (
+	IdempotencyPending   = "pending"
+	IdempotencyCompleted = "completed"
+)
+
+type IdempotencyKeyId struct {
+	Tenant string `bson:"tenant,omitempty"`
+	Actor  string `bson:"actor"`
+	Key    string `bson:"key"`
+}
+
+// IdempotencyRecord remembers a request made with an Idempotency-Key and, once it completed, its response.
+type IdempotencyRecord struct {
+	Id             IdempotencyKeyId  `bson:"_id"`
+	RequestHash    string            `bson:"request_hash"`
+	Method         string            `bson:"method"`
+	Path           string            `bson:"path"`
+	Status         string            `bson:"status"`
+	ResponseStatus int               `bson:"response_status,omitempty"`
+	ResponseBody   []byte            `bson:"response_body,omitempty"`
+	ResponseHeader map[string]string `bson:"response_header,omitempty"`
+	CreatedAt      time.Time         `bson:"created_at"`
+}
@@ -5,31 +5,86 @@ import (
 	"time"
 )
 
+// Product is a stored product. PendingIncoming and PendingOutgoing are not stored
+// but derived from document lines when a read asks for them.
 type Product struct {
-	Id          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name        string             `json:"name" bson:"name"`
-	Description string             `json:"description" bson:"description"`
-	CreatedAt   time.Time          `json:"created_at,omitempty" bson:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at,omitempty" bson:"updated_at"`
-	Quantity    *float32           `json:"quantity" bson:"quantity"`
+	Id              primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	TenantId        string             `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	Name            string             `json:"name" bson:"name"`
+	Description     string             `json:"description" bson:"description"`
+	CreatedAt       time.Time          `json:"created_at,omitempty" bson:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at,omitempty" bson:"updated_at"`
+	CreatedBy       *Actor             `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	UpdatedBy       *Actor             `json:"updated_by,omitempty" bson:"updated_by,omitempty"`
+	Version         int64              `json:"version" bson:"version"`
+	Unit            string             `json:"unit" bson:"unit"`
+	Quantity        *Decimal           `json:"quantity" bson:"quantity" swaggertype:"number"`
+	Deleted         bool               `json:"deleted,omitempty" bson:"deleted,omitempty"`
+	DeletedAt       *time.Time         `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy       *Actor             `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+	PendingIncoming *Decimal           `json:"pending_incoming,omitempty" bson:"-" swaggertype:"number"`
+	PendingOutgoing *Decimal           `json:"pending_outgoing,omitempty" bson:"-" swaggertype:"number"`
 }
 
 type CreateProductRequest struct {
 	Name        string    `json:"name" bson:"name" validate:"required"`
 	Description string    `json:"description" bson:"description"`
+	Unit        string    `json:"unit" bson:"unit"`
 	CreatedAt   time.Time `json:"-" bson:"created_at"`
 	UpdatedAt   time.Time `json:"-" bson:"updated_at"`
+	TenantId    string    `json:"-" bson:"tenant_id,omitempty"`
+	CreatedBy   *Actor    `json:"-" bson:"created_by,omitempty"`
+	UpdatedBy   *Actor    `json:"-" bson:"updated_by,omitempty"`
+	Version     int64     `json:"-" bson:"version"`
 }
 
 type UpdateProductRequest struct {
 	Id          primitive.ObjectID `json:"id" bson:"_id" validate:"required"`
 	Name        string             `json:"name" bson:"name" validate:"required"`
 	Description string             `json:"description" bson:"description"`
+	Unit        *string            `json:"unit,omitempty" bson:"unit,omitempty"`
 	UpdatedAt   time.Time          `json:"-" bson:"updated_at"`
+	UpdatedBy   *Actor             `json:"-" bson:"updated_by,omitempty"`
+}
+
+// PatchProductRequest is the mutable part of a product that PATCH requests are applied to.
+type PatchProductRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+}
+
+// ProductPatchableFields maps the JSON names of PatchProductRequest fields to their document fields.
+var ProductPatchableFields = map[string]string{
+	"name":        "name",
+	"description": "description",
+	"unit":        "unit",
 }
 
 type UpdateProductEvent struct {
 	Id        primitive.ObjectID `bson:"_id" validate:"required"`
-	Quantity  *float32           `bson:"quantity"`
+	Quantity  *Decimal           `bson:"quantity"`
 	UpdatedAt time.Time          `bson:"updated_at"`
+	UpdatedBy *Actor             `bson:"updated_by,omitempty"`
+}
+
+type BatchDeleteResponse struct {
+	Deleted        []string `json:"deleted"`
+	AlreadyDeleted []string `json:"alreadyDeleted"`
+	NotFound       []string `json:"notFound"`
+}
+
+type BatchRestoreResponse struct {
+	Restored  []string `json:"restored"`
+	Conflicts []string `json:"conflicts"`
+	NotFound  []string `json:"notFound"`
+}
+
+type PurgeReport struct {
+	Cutoff     time.Time        `json:"cutoff"`
+	DryRun     bool             `json:"dryRun"`
+	Candidates int64            `json:"candidates"`
+	Purged     int64            `json:"purged"`
+	Dependents map[string]int64 `json:"dependents"`
+	SampleIds  []string         `json:"sampleIds"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	HistoryOpCreate      = "create"
+	HistoryOpUpdate      = "update"
+	HistoryOpPatch       = "patch"
+	HistoryOpStockUpdate = "stock_update"
+	HistoryOpDelete      = "delete"
+	HistoryOpRestore     = "restore"
+)
+
+// ProductHistoryEntry records one write of a product. Timestamp equals the updated_at
+// the write gave the product and Version the version it produced.
+type ProductHistoryEntry struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProductId primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Version   int64              `json:"version" bson:"version"`
+	Actor     Actor              `json:"actor" bson:"actor"`
+	Timestamp time.Time          `json:"timestamp" bson:"timestamp"`
+	Operation string             `json:"operation" bson:"operation"`
+	Changes   []FieldChange      `json:"changes" bson:"changes"`
+}
+
+// FieldChange is the value of a top-level product field before and after a write.
+// BeforeExists and AfterExists tell a missing field from one holding null.
+type FieldChange struct {
+	Field        string      `json:"field" bson:"field"`
+	Before       interface{} `json:"before" bson:"before" swaggertype:"object"`
+	BeforeExists bool        `json:"before_exists" bson:"before_exists"`
+	After        interface{} `json:"after" bson:"after" swaggertype:"object"`
+	AfterExists  bool        `json:"after_exists" bson:"after_exists"`
+}
+
+type HistoryQueryRequest struct {
+	QueryRequest
+	Field string `json:"field,omitempty" query:"field"`
+	Actor string `json:"actor,omitempty" query:"actor"`
+}
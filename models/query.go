@@ -1,10 +1,10 @@
 package models
 
 type QueryRequest struct {
-	Rows      int64  `json:"rows" validate:"required,min=5,max=30"`
-	Offset    int64  `json:"offset,omitempty" validate:"min=0"`
-	SortField string `json:"sortField"`
-	SortOrder int    `json:"sortOrder,omitempty" validate:"oneof=-1 0 1"`
+	Rows      int64  `json:"rows" query:"rows" validate:"required,min=5,max=30"`
+	Offset    int64  `json:"offset,omitempty" query:"offset" validate:"min=0"`
+	SortField string `json:"sortField" query:"sortField"`
+	SortOrder int    `json:"sortOrder,omitempty" query:"sortOrder" validate:"oneof=-1 0 1"`
 }
 
 type QueryResponse[T any] struct {
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	WebhookEventDocumentStatusChanged = "document.status_changed"
+
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookSubscription receives the status changes of documents moving to one of its statuses,
+// or to any status for "*". Payloads are signed with its secret, which is returned once, on creation.
+type WebhookSubscription struct {
+	Id        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TenantId  string             `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	Url       string             `json:"url" bson:"url"`
+	Statuses  []string           `json:"statuses" bson:"statuses"`
+	Secret    string             `json:"-" bson:"secret"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	CreatedBy *Actor             `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	DeletedAt *time.Time         `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+}
+
+type CreateWebhookSubscriptionRequest struct {
+	Url      string   `json:"url" validate:"required,url,startswith=http"`
+	Statuses []string `json:"statuses" validate:"required,min=1,dive,required"`
+	Secret   string   `json:"secret,omitempty" validate:"omitempty,min=16"`
+}
+
+// CreatedWebhookSubscription carries the signing secret, which cannot be retrieved again later.
+type CreatedWebhookSubscription struct {
+	WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// WebhookPayload is the JSON body posted to subscribers.
+type WebhookPayload struct {
+	Id         string       `json:"id" bson:"id"`
+	Type       string       `json:"type" bson:"type"`
+	TenantId   string       `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	DocumentId string       `json:"document_id" bson:"document_id"`
+	From       string       `json:"from" bson:"from"`
+	To         string       `json:"to" bson:"to"`
+	Timestamp  time.Time    `json:"timestamp" bson:"timestamp"`
+	Source     *EventSource `json:"source,omitempty" bson:"source,omitempty"`
+}
+
+type WebhookAttempt struct {
+	At         time.Time `json:"at" bson:"at"`
+	StatusCode int       `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms" bson:"duration_ms"`
+}
+
+// WebhookDelivery is the delivery of one payload to one subscription, with its latest attempts.
+type WebhookDelivery struct {
+	Id             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TenantId       string             `json:"tenant_id,omitempty" bson:"tenant_id,omitempty"`
+	SubscriptionId primitive.ObjectID `json:"subscription_id" bson:"subscription_id"`
+	Payload        WebhookPayload     `json:"payload" bson:"payload"`
+	Status         string             `json:"status" bson:"status" enums:"pending,delivered,failed"`
+	AttemptCount   int                `json:"attempt_count" bson:"attempt_count"`
+	Attempts       []WebhookAttempt   `json:"attempts" bson:"attempts"`
+	NextAttemptAt  *time.Time         `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	DeliveredAt    *time.Time         `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	// LeaseId identifies the claim of the dispatcher currently sending the delivery.
+	LeaseId *primitive.ObjectID `json:"-" bson:"lease_id,omitempty"`
+}
+
+type WebhookDeliveryQueryRequest struct {
+	QueryRequest
+	SubscriptionId string `json:"subscriptionId,omitempty"`
+	DocumentId     string `json:"documentId,omitempty"`
+	Status         string `json:"status,omitempty" validate:"omitempty,oneof=pending delivered failed"`
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"msrd-products/auth"
+	"msrd-products/controllers"
+	"os"
+)
+
+// apiKeyPolicy declares the permission each API key route requires.
+// Entries are overridden through API_KEY_ROUTE_PERMISSIONS.
+var apiKeyPolicy = auth.Policy{
+	"GET /":            auth.PermissionApiKeysAdmin,
+	"POST /":           auth.PermissionApiKeysAdmin,
+	"POST /:id/rotate": auth.PermissionApiKeysAdmin,
+	"DELETE /:id":      auth.PermissionApiKeysAdmin,
+}
+
+func ApiKeyRoute(router fiber.Router) {
+	policy := apiKeyPolicy.WithOverrides(os.Getenv("API_KEY_ROUTE_PERMISSIONS"))
+
+	router.Get("/", policy.Require(fiber.MethodGet, "/"), controllers.ListApiKeys)
+	router.Post("/", policy.Require(fiber.MethodPost, "/"), controllers.IssueApiKey)
+	router.Post("/:id/rotate", policy.Require(fiber.MethodPost, "/:id/rotate"), controllers.RotateApiKey)
+	router.Delete("/:id", policy.Require(fiber.MethodDelete, "/:id"), controllers.RevokeApiKey)
+}
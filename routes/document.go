@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"msrd-products/auth"
+	"msrd-products/controllers"
+	"os"
+)
+
+// documentPolicy declares the permission each document route requires.
+// Entries are overridden through DOCUMENT_ROUTE_PERMISSIONS.
+var documentPolicy = auth.Policy{
+	"POST /quarantine/query":      auth.PermissionDocumentsAdmin,
+	"GET /quarantine/:id":         auth.PermissionDocumentsAdmin,
+	"POST /quarantine/:id/replay": auth.PermissionDocumentsAdmin,
+	"GET /summary":                auth.PermissionDocumentsRead,
+	"POST /query":                 auth.PermissionDocumentsRead,
+	"GET /:id":                    auth.PermissionDocumentsRead,
+	"GET /:id/status-history":     auth.PermissionDocumentsRead,
+	"GET /:id/lines":              auth.PermissionDocumentsRead,
+}
+
+func DocumentRoute(router fiber.Router) {
+	policy := documentPolicy.WithOverrides(os.Getenv("DOCUMENT_ROUTE_PERMISSIONS"))
+
+	router.Post("/quarantine/query", policy.Require(fiber.MethodPost, "/quarantine/query"), controllers.QueryQuarantinedEvents)
+	router.Get("/quarantine/:id", policy.Require(fiber.MethodGet, "/quarantine/:id"), controllers.GetQuarantinedEvent)
+	router.Post("/quarantine/:id/replay", policy.Require(fiber.MethodPost, "/quarantine/:id/replay"), controllers.ReplayQuarantinedEvent)
+	router.Get("/summary", policy.Require(fiber.MethodGet, "/summary"), controllers.GetDocumentStatusSummary)
+	router.Post("/query", policy.Require(fiber.MethodPost, "/query"), controllers.QueryDocuments)
+	router.Get("/:id", policy.Require(fiber.MethodGet, "/:id"), controllers.GetDocument)
+	router.Get("/:id/status-history", policy.Require(fiber.MethodGet, "/:id/status-history"), controllers.GetDocumentStatusHistory)
+	router.Get("/:id/lines", policy.Require(fiber.MethodGet, "/:id/lines"), controllers.GetDocumentLines)
+}
@@ -2,14 +2,46 @@ package routes
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"msrd-products/auth"
 	"msrd-products/controllers"
+	"msrd-products/middleware"
+	"msrd-products/utils"
+	"os"
 )
 
+// productPolicy declares the permission each product route requires.
+// Entries are overridden through PRODUCT_ROUTE_PERMISSIONS, e.g. "POST /batchDelete=products:admin".
+var productPolicy = auth.Policy{
+	"GET /trash":         auth.PermissionProductsDelete,
+	"GET /:id":           auth.PermissionProductsRead,
+	"GET /:id/history":   auth.PermissionProductsRead,
+	"POST /query":        auth.PermissionProductsRead,
+	"POST /":             auth.PermissionProductsWrite,
+	"PUT /":              auth.PermissionProductsWrite,
+	"PATCH /:id":         auth.PermissionProductsWrite,
+	"DELETE /:id":        auth.PermissionProductsDelete,
+	"POST /batch":        auth.PermissionProductsWrite,
+	"POST /batchDelete":  auth.PermissionProductsDelete,
+	"POST /:id/restore":  auth.PermissionProductsDelete,
+	"POST /batchRestore": auth.PermissionProductsDelete,
+}
+
 func ProductRoute(router fiber.Router) {
-	router.Get("/:id", controllers.GetProduct)
-	router.Post("/query", controllers.QueryProducts)
-	router.Post("/", controllers.AddProduct)
-	router.Put("/", controllers.UpdateProduct)
-	router.Delete("/:id", controllers.DeleteProduct)
-	router.Post("/batchDelete", controllers.BatchDeleteProduct)
+	policy := productPolicy.WithOverrides(os.Getenv("PRODUCT_ROUTE_PERMISSIONS"))
+	idempotent := middleware.Idempotency()
+	productCache := middleware.CacheControl(utils.StringEnv("CACHE_CONTROL_PRODUCT_GET", "private, no-cache"))
+	queryCache := middleware.CacheControl(utils.StringEnv("CACHE_CONTROL_PRODUCT_QUERY", "private, no-cache"))
+
+	router.Get("/trash", policy.Require(fiber.MethodGet, "/trash"), controllers.QueryTrash)
+	router.Get("/:id", policy.Require(fiber.MethodGet, "/:id"), productCache, controllers.GetProduct)
+	router.Get("/:id/history", policy.Require(fiber.MethodGet, "/:id/history"), controllers.GetProductHistory)
+	router.Post("/query", policy.Require(fiber.MethodPost, "/query"), queryCache, controllers.QueryProducts)
+	router.Post("/", policy.Require(fiber.MethodPost, "/"), idempotent, controllers.AddProduct)
+	router.Put("/", policy.Require(fiber.MethodPut, "/"), idempotent, controllers.UpdateProduct)
+	router.Patch("/:id", policy.Require(fiber.MethodPatch, "/:id"), idempotent, controllers.PatchProduct)
+	router.Delete("/:id", policy.Require(fiber.MethodDelete, "/:id"), controllers.DeleteProduct)
+	router.Post("/batch", policy.Require(fiber.MethodPost, "/batch"), idempotent, controllers.BatchProducts)
+	router.Post("/batchDelete", policy.Require(fiber.MethodPost, "/batchDelete"), idempotent, controllers.BatchDeleteProduct)
+	router.Post("/:id/restore", policy.Require(fiber.MethodPost, "/:id/restore"), controllers.RestoreProduct)
+	router.Post("/batchRestore", policy.Require(fiber.MethodPost, "/batchRestore"), idempotent, controllers.BatchRestoreProduct)
 }
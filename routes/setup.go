@@ -8,4 +8,7 @@ func SetupRoutes(app *fiber.App) {
 
 	api := app.Group("/api")
 	ProductRoute(api.Group("/products"))
+	DocumentRoute(api.Group("/documents"))
+	WebhookRoute(api.Group("/webhooks"))
+	ApiKeyRoute(api.Group("/apiKeys"))
 }
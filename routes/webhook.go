@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"msrd-products/auth"
+	"msrd-products/controllers"
+	"os"
+)
+
+// webhookPolicy declares the permission each webhook route requires.
+// Entries are overridden through WEBHOOK_ROUTE_PERMISSIONS.
+var webhookPolicy = auth.Policy{
+	"GET /":                          auth.PermissionWebhooksAdmin,
+	"POST /":                         auth.PermissionWebhooksAdmin,
+	"POST /deliveries/query":         auth.PermissionWebhooksAdmin,
+	"GET /deliveries/:id":            auth.PermissionWebhooksAdmin,
+	"POST /deliveries/:id/redeliver": auth.PermissionWebhooksAdmin,
+	"DELETE /:id":                    auth.PermissionWebhooksAdmin,
+}
+
+func WebhookRoute(router fiber.Router) {
+	policy := webhookPolicy.WithOverrides(os.Getenv("WEBHOOK_ROUTE_PERMISSIONS"))
+
+	router.Get("/", policy.Require(fiber.MethodGet, "/"), controllers.ListWebhookSubscriptions)
+	router.Post("/", policy.Require(fiber.MethodPost, "/"), controllers.CreateWebhookSubscription)
+	router.Post("/deliveries/query", policy.Require(fiber.MethodPost, "/deliveries/query"), controllers.QueryWebhookDeliveries)
+	router.Get("/deliveries/:id", policy.Require(fiber.MethodGet, "/deliveries/:id"), controllers.GetWebhookDelivery)
+	router.Post("/deliveries/:id/redeliver", policy.Require(fiber.MethodPost, "/deliveries/:id/redeliver"), controllers.RedeliverWebhook)
+	router.Delete("/:id", policy.Require(fiber.MethodDelete, "/:id"), controllers.DeleteWebhookSubscription)
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidETag = errors.New("invalid entity tag")
+
+// VersionETag formats a record version as a strong entity tag.
+func VersionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ParseVersionETag reads back a version from an If-Match value produced by VersionETag.
+func ParseVersionETag(tag string) (int64, error) {
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+		return 0, ErrInvalidETag
+	}
+
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidETag
+	}
+	return version, nil
+}
@@ -0,0 +1,307 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch    = errors.New("invalid patch")
+	ErrPatchTestFailed = errors.New("patch test operation failed")
+)
+
+// PatchOperation is one operation of an RFC 6902 JSON Patch document.
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// MergePatch applies an RFC 7396 JSON Merge Patch to a copy of a decoded JSON document,
+// leaving the target unchanged.
+func MergePatch(target interface{}, patch interface{}) interface{} {
+	return mergePatch(deepCopy(target), patch)
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+
+	return targetObject
+}
+
+// MergePatchFields lists the top-level members a merge patch touches.
+func MergePatchFields(patch interface{}) (fields []string) {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return []string{""}
+	}
+	for key := range patchObject {
+		fields = append(fields, key)
+	}
+	return
+}
+
+// JSONPatchFields lists the top-level members the operations of a JSON Patch read or write.
+func JSONPatchFields(operations []PatchOperation) (fields []string) {
+	for _, operation := range operations {
+		fields = append(fields, topLevelField(operation.Path))
+		if operation.Op == "move" || operation.Op == "copy" {
+			fields = append(fields, topLevelField(operation.From))
+		}
+	}
+	return
+}
+
+// ApplyJSONPatch applies RFC 6902 operations in order to a copy of a decoded JSON document,
+// leaving the document unchanged.
+func ApplyJSONPatch(document interface{}, operations []PatchOperation) (interface{}, error) {
+	var err error
+	document = deepCopy(document)
+	for _, operation := range operations {
+		switch operation.Op {
+		case "add":
+			document, err = addValue(document, operation.Path, operation.Value)
+		case "remove":
+			document, _, err = removeValue(document, operation.Path)
+		case "replace":
+			if operation.Path == "" {
+				document = operation.Value
+				break
+			}
+			document, _, err = removeValue(document, operation.Path)
+			if err == nil {
+				document, err = addValue(document, operation.Path, operation.Value)
+			}
+		case "move":
+			var value interface{}
+			document, value, err = removeValue(document, operation.From)
+			if err == nil {
+				document, err = addValue(document, operation.Path, value)
+			}
+		case "copy":
+			var value interface{}
+			value, err = getValue(document, operation.From)
+			if err == nil {
+				document, err = addValue(document, operation.Path, deepCopy(value))
+			}
+		case "test":
+			var value interface{}
+			value, err = getValue(document, operation.Path)
+			if err == nil && !jsonEqual(value, operation.Value) {
+				err = fmt.Errorf("%w: %s", ErrPatchTestFailed, operation.Path)
+			}
+		default:
+			err = fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, operation.Op)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return document, nil
+}
+
+func topLevelField(path string) string {
+	tokens, err := parsePointer(path)
+	if err != nil || len(tokens) == 0 {
+		return ""
+	}
+	return tokens[0]
+}
+
+func parsePointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("%w: malformed pointer %q", ErrInvalidPatch, path)
+	}
+
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// navigate resolves every token of a pointer but the last, returning the container and the last token.
+func navigate(document interface{}, path string) (interface{}, string, error) {
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(tokens) == 0 {
+		return nil, "", nil
+	}
+
+	container := document
+	for _, token := range tokens[:len(tokens)-1] {
+		container, err = child(container, token)
+		if err != nil {
+			return nil, "", fmt.Errorf("%w: path %q does not exist", ErrInvalidPatch, path)
+		}
+	}
+	return container, tokens[len(tokens)-1], nil
+}
+
+func child(container interface{}, token string) (interface{}, error) {
+	switch node := container.(type) {
+	case map[string]interface{}:
+		value, ok := node[token]
+		if !ok {
+			return nil, ErrInvalidPatch
+		}
+		return value, nil
+	case []interface{}:
+		index, err := strconv.Atoi(token)
+		if err != nil || index < 0 || index >= len(node) {
+			return nil, ErrInvalidPatch
+		}
+		return node[index], nil
+	default:
+		return nil, ErrInvalidPatch
+	}
+}
+
+func getValue(document interface{}, path string) (interface{}, error) {
+	container, token, err := navigate(document, path)
+	if err != nil {
+		return nil, err
+	}
+	if container == nil && token == "" {
+		return document, nil
+	}
+
+	value, err := child(container, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: path %q does not exist", ErrInvalidPatch, path)
+	}
+	return value, nil
+}
+
+// addValue returns the document because replacing the root, or appending to an array, yields a new value.
+func addValue(document interface{}, path string, value interface{}) (interface{}, error) {
+	if path == "" {
+		return value, nil
+	}
+
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	container, token, err := navigate(document, path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := container.(type) {
+	case map[string]interface{}:
+		node[token] = value
+		return document, nil
+	case []interface{}:
+		index := len(node)
+		if token != "-" {
+			index, err = strconv.Atoi(token)
+			if err != nil || index < 0 || index > len(node) {
+				return nil, fmt.Errorf("%w: invalid array index in %q", ErrInvalidPatch, path)
+			}
+		}
+		updated := append(node[:index:index], append([]interface{}{value}, node[index:]...)...)
+		return replaceContainer(document, tokens[:len(tokens)-1], updated)
+	default:
+		return nil, fmt.Errorf("%w: cannot add to %q", ErrInvalidPatch, path)
+	}
+}
+
+func removeValue(document interface{}, path string) (interface{}, interface{}, error) {
+	if path == "" {
+		return nil, nil, fmt.Errorf("%w: cannot remove the document root", ErrInvalidPatch)
+	}
+
+	tokens, err := parsePointer(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	container, token, err := navigate(document, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value, err := child(container, token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: path %q does not exist", ErrInvalidPatch, path)
+	}
+
+	switch node := container.(type) {
+	case map[string]interface{}:
+		delete(node, token)
+		return document, value, nil
+	case []interface{}:
+		index, _ := strconv.Atoi(token)
+		updated := append(node[:index:index], node[index+1:]...)
+		document, err = replaceContainer(document, tokens[:len(tokens)-1], updated)
+		return document, value, err
+	default:
+		return nil, nil, fmt.Errorf("%w: cannot remove %q", ErrInvalidPatch, path)
+	}
+}
+
+// replaceContainer swaps the array found at tokens for an updated copy.
+func replaceContainer(document interface{}, tokens []string, updated interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return updated, nil
+	}
+
+	parent := document
+	for _, token := range tokens[:len(tokens)-1] {
+		var err error
+		parent, err = child(parent, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = updated
+	case []interface{}:
+		index, _ := strconv.Atoi(last)
+		node[index] = updated
+	}
+	return document, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	data, _ := json.Marshal(value)
+	var copied interface{}
+	_ = json.Unmarshal(data, &copied)
+	return copied
+}
+
+func jsonEqual(a interface{}, b interface{}) bool {
+	return reflect.DeepEqual(deepCopy(a), deepCopy(b))
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, data string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		t.Fatalf("invalid JSON %s: %s", data, err)
+	}
+	return value
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name, target, patch, expected string
+	}{
+		{"replaces a member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"adds a member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"removes a member", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"merges nested objects", `{"a":{"b":"c","d":"e"}}`, `{"a":{"d":null,"f":"g"}}`, `{"a":{"b":"c","f":"g"}}`},
+		{"replaces arrays", `{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{"replaces a non-object target", `{"a":"b"}`, `{"a":{"c":"d"}}`, `{"a":{"c":"d"}}`},
+		{"replaces the document with a non-object patch", `{"a":"b"}`, `["c"]`, `["c"]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			patched := MergePatch(decode(t, test.target), decode(t, test.patch))
+			if !reflect.DeepEqual(patched, decode(t, test.expected)) {
+				t.Errorf("got %v, want %s", patched, test.expected)
+			}
+		})
+	}
+}
+
+func TestMergePatchLeavesTargetUnchanged(t *testing.T) {
+	target := decode(t, `{"name":"a","unit":"kg","nested":{"x":1}}`)
+
+	MergePatch(target, decode(t, `{"name":"b","unit":null,"nested":{"x":2}}`))
+
+	if !reflect.DeepEqual(target, decode(t, `{"name":"a","unit":"kg","nested":{"x":1}}`)) {
+		t.Errorf("target was changed to %v", target)
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, document, operations, expected string
+	}{
+		{"adds a member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"inserts into an array", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`},
+		{"appends to an array", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`},
+		{"removes a member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`},
+		{"removes an array item", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`},
+		{"replaces a member", `{"a":1}`, `[{"op":"replace","path":"/a","value":2}]`, `{"a":2}`},
+		{"moves a member", `{"a":1}`, `[{"op":"move","from":"/a","path":"/b"}]`, `{"b":1}`},
+		{"copies a member", `{"a":{"x":1}}`, `[{"op":"copy","from":"/a","path":"/b"}]`, `{"a":{"x":1},"b":{"x":1}}`},
+		{"passes a test", `{"a":"x"}`, `[{"op":"test","path":"/a","value":"x"},{"op":"replace","path":"/a","value":"y"}]`, `{"a":"y"}`},
+		{"unescapes pointers", `{"a/b":1,"c~d":2}`, `[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/c~0d"}]`, `{}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var operations []PatchOperation
+			if err := json.Unmarshal([]byte(test.operations), &operations); err != nil {
+				t.Fatal(err)
+			}
+
+			patched, err := ApplyJSONPatch(decode(t, test.document), operations)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(patched, decode(t, test.expected)) {
+				t.Errorf("got %v, want %s", patched, test.expected)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name, operations string
+		expected         error
+	}{
+		{"failed test", `[{"op":"test","path":"/a","value":2}]`, ErrPatchTestFailed},
+		{"missing member", `[{"op":"remove","path":"/missing"}]`, ErrInvalidPatch},
+		{"missing parent", `[{"op":"add","path":"/missing/b","value":1}]`, ErrInvalidPatch},
+		{"array index out of range", `[{"op":"add","path":"/list/5","value":1}]`, ErrInvalidPatch},
+		{"malformed pointer", `[{"op":"add","path":"a","value":1}]`, ErrInvalidPatch},
+		{"unknown operation", `[{"op":"merge","path":"/a","value":1}]`, ErrInvalidPatch},
+		{"removing the root", `[{"op":"remove","path":""}]`, ErrInvalidPatch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var operations []PatchOperation
+			if err := json.Unmarshal([]byte(test.operations), &operations); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := ApplyJSONPatch(decode(t, `{"a":1,"list":[1]}`), operations)
+			if !errors.Is(err, test.expected) {
+				t.Errorf("got %v, want %v", err, test.expected)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatchLeavesDocumentUnchanged(t *testing.T) {
+	document := decode(t, `{"name":"a","unit":"kg","tags":["x"]}`)
+	var operations []PatchOperation
+	_ = json.Unmarshal([]byte(`[{"op":"replace","path":"/name","value":"b"},{"op":"remove","path":"/unit"},{"op":"add","path":"/tags/0","value":"y"}]`), &operations)
+
+	if _, err := ApplyJSONPatch(document, operations); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(document, decode(t, `{"name":"a","unit":"kg","tags":["x"]}`)) {
+		t.Errorf("document was changed to %v", document)
+	}
+}
+
+func TestPatchFields(t *testing.T) {
+	fields := MergePatchFields(decode(t, `{"name":"b"}`))
+	if !reflect.DeepEqual(fields, []string{"name"}) {
+		t.Errorf("merge patch fields: got %v", fields)
+	}
+
+	var operations []PatchOperation
+	_ = json.Unmarshal([]byte(`[{"op":"move","from":"/unit","path":"/name/x"}]`), &operations)
+	fields = JSONPatchFields(operations)
+	if !reflect.DeepEqual(fields, []string{"name", "unit"}) {
+		t.Errorf("JSON patch fields: got %v", fields)
+	}
+}